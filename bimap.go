@@ -0,0 +1,176 @@
+package avl
+
+// BiMap is an immutable one-to-one mapping between keys and values.
+// It holds two trees: the forward one ordered by keys and the inverse one
+// ordered by values, such that both keys and values are unique.
+//
+// Modifying operations update both trees at once and return a copy of the
+// map. Like Tree, BiMap is a reference type and the zero value is an empty
+// map.
+type BiMap struct {
+	forward Tree
+	inverse Tree
+}
+
+// Size returns the number of pairs in the map.
+// The time complexity is O(1).
+func (m BiMap) Size() int {
+	return m.forward.Size()
+}
+
+// Get returns the value mapped to key or nil.
+func (m BiMap) Get(key Item) Item {
+	_, v := m.Forward().Search(key)
+	return v
+}
+
+// GetInverse returns the key mapped to value or nil.
+func (m BiMap) GetInverse(value Item) Item {
+	_, k := m.Inverse().Search(value)
+	return k
+}
+
+// Insert inserts a pair of key and value in the map.
+// It returns a copy of the map or ErrConflict if key or value is already
+// present in the map.
+func (m BiMap) Insert(key, value Item) (BiMap, error) {
+	if m.Get(key) != nil || m.GetInverse(value) != nil {
+		return m, ErrConflict
+	}
+	m.forward, _ = m.forward.Insert(biEntry{key, value})
+	m.inverse, _ = m.inverse.Insert(biEntry{value, key})
+	return m, nil
+}
+
+// Put puts a pair of key and value in the map, replacing the pairs holding
+// key or value. It returns a copy of the map, the value previously mapped to
+// key and the key previously mapped to value.
+func (m BiMap) Put(key, value Item) (_ BiMap, prevValue, prevKey Item) {
+	m, prevValue = m.Delete(key)
+	m, prevKey = m.DeleteInverse(value)
+	m.forward, _ = m.forward.Insert(biEntry{key, value})
+	m.inverse, _ = m.inverse.Insert(biEntry{value, key})
+	return m, prevValue, prevKey
+}
+
+// Delete deletes the pair holding key.
+// It returns a copy of the map and the value of deleted pair if it was
+// present.
+func (m BiMap) Delete(key Item) (_ BiMap, value Item) {
+	var e Item
+	m.forward, e = m.forward.Delete(biKey{key})
+	if e == nil {
+		return m, nil
+	}
+	value = e.(biEntry).value
+	m.inverse, _ = m.inverse.Delete(biKey{value})
+	return m, value
+}
+
+// DeleteInverse deletes the pair holding value.
+// It returns a copy of the map and the key of deleted pair if it was present.
+func (m BiMap) DeleteInverse(value Item) (_ BiMap, key Item) {
+	var e Item
+	m.inverse, e = m.inverse.Delete(biKey{value})
+	if e == nil {
+		return m, nil
+	}
+	key = e.(biEntry).value
+	m.forward, _ = m.forward.Delete(biKey{key})
+	return m, key
+}
+
+// Forward returns the side of the map ordered by keys.
+func (m BiMap) Forward() BiMapSide {
+	return BiMapSide{m.forward}
+}
+
+// Inverse returns the side of the map ordered by values.
+func (m BiMap) Inverse() BiMapSide {
+	return BiMapSide{m.inverse}
+}
+
+// BiMapSide is an ordered view of one side of a BiMap.
+//
+// Its methods work with pairs as (k, v), where k is an item of the side and v
+// is the item mapped to it. That is, for the inverse side k is the value and
+// v is the key of a pair. Methods return nil k and v if there is no pair
+// found.
+type BiMapSide struct {
+	tree Tree
+}
+
+// Size returns the number of pairs.
+// The time complexity is O(1).
+func (s BiMapSide) Size() int {
+	return s.tree.Size()
+}
+
+// Min returns the pair having the minimum k.
+func (s BiMapSide) Min() (k, v Item) {
+	return biPair(s.tree.Min())
+}
+
+// Max returns the pair having the maximum k.
+func (s BiMapSide) Max() (k, v Item) {
+	return biPair(s.tree.Max())
+}
+
+// Search searches for a pair having k equal to x.
+func (s BiMapSide) Search(x Item) (k, v Item) {
+	return biPair(s.tree.Search(biKey{x}))
+}
+
+// Predecessor returns the pair having the greatest k less than x.
+func (s BiMapSide) Predecessor(x Item) (k, v Item) {
+	return biPair(s.tree.Predecessor(biKey{x}))
+}
+
+// Successor returns the pair having the least k greater than x.
+func (s BiMapSide) Successor(x Item) (k, v Item) {
+	return biPair(s.tree.Successor(biKey{x}))
+}
+
+// Range calls fn for each pair having k greater than or equal to lo and less
+// than hi in order. Nil lo or hi means no lower or upper bound respectively.
+// If fn returns false Range stops.
+func (s BiMapSide) Range(lo, hi Item, fn func(k, v Item) bool) {
+	var a, b Item
+	if lo != nil {
+		a = biKey{lo}
+	}
+	if hi != nil {
+		b = biKey{hi}
+	}
+	s.tree.root.ascend(a, b, func(x Item) bool {
+		return fn(biPair(x))
+	})
+}
+
+func biPair(x Item) (k, v Item) {
+	if x == nil {
+		return nil, nil
+	}
+	e := x.(biEntry)
+	return e.key, e.value
+}
+
+// biEntry is an item of BiMap trees. For the inverse tree key and value are
+// swapped.
+type biEntry struct {
+	key   Item
+	value Item
+}
+
+func (e biEntry) Compare(x Item) int {
+	return e.key.Compare(x.(biEntry).key)
+}
+
+// biKey is used to search BiMap trees by key.
+type biKey struct {
+	key Item
+}
+
+func (k biKey) Compare(x Item) int {
+	return k.key.Compare(x.(biEntry).key)
+}
@@ -0,0 +1,93 @@
+package avl
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBiMap(t *testing.T) {
+	var (
+		m   BiMap
+		err error
+	)
+	for i, name := range []string{"c", "a", "d", "b"} {
+		if m, err = m.Insert(strItem(name), IntItem(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev := m
+	if _, err := m.Insert(strItem("a"), IntItem(10)); err != ErrConflict {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrConflict)
+	}
+	if _, err := m.Insert(strItem("x"), IntItem(0)); err != ErrConflict {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrConflict)
+	}
+	assertBiMap(t, m, "a:1 b:3 c:0 d:2", "0:c 1:a 2:d 3:b")
+
+	// Put replaces both the pair holding "a" and the pair holding 2.
+	m, pv, pk := m.Put(strItem("a"), IntItem(2))
+	if pv != IntItem(1) || pk != strItem("d") {
+		t.Fatalf("unexpected replaced items: %v and %v", pv, pk)
+	}
+	assertBiMap(t, m, "a:2 b:3 c:0", "0:c 2:a 3:b")
+
+	m, k := m.DeleteInverse(IntItem(0))
+	if k != strItem("c") {
+		t.Fatalf("unexpected deleted key: %v", k)
+	}
+	m, v := m.Delete(strItem("b"))
+	if v != IntItem(3) {
+		t.Fatalf("unexpected deleted value: %v", v)
+	}
+	assertBiMap(t, m, "a:2", "2:a")
+	assertBiMap(t, prev, "a:1 b:3 c:0 d:2", "0:c 1:a 2:d 3:b")
+
+	if v := prev.Get(strItem("d")); v != IntItem(2) {
+		t.Fatalf("unexpected Get() result: %v", v)
+	}
+	if k := prev.GetInverse(IntItem(3)); k != strItem("b") {
+		t.Fatalf("unexpected GetInverse() result: %v", k)
+	}
+	if k, v := prev.Inverse().Predecessor(IntItem(2)); k != IntItem(1) || v != strItem("a") {
+		t.Fatalf("unexpected Predecessor() result: %v:%v", k, v)
+	}
+	if k, v := prev.Forward().Successor(strItem("bb")); k != strItem("c") || v != IntItem(0) {
+		t.Fatalf("unexpected Successor() result: %v:%v", k, v)
+	}
+	if k, _ := prev.Forward().Successor(strItem("d")); k != nil {
+		t.Fatalf("unexpected Successor() result: %v", k)
+	}
+	var act []string
+	prev.Forward().Range(strItem("b"), strItem("d"), func(k, v Item) bool {
+		act = append(act, fmt.Sprintf("%v:%v", k, v))
+		return true
+	})
+	if s := strings.Join(act, " "); s != "b:3 c:0" {
+		t.Fatalf("unexpected range: %q", s)
+	}
+}
+
+func assertBiMap(t *testing.T, m BiMap, forward, inverse string) {
+	t.Helper()
+	for _, test := range []struct {
+		name string
+		side BiMapSide
+		exp  string
+	}{
+		{"forward", m.Forward(), forward},
+		{"inverse", m.Inverse(), inverse},
+	} {
+		var act []string
+		test.side.Range(nil, nil, func(k, v Item) bool {
+			act = append(act, fmt.Sprintf("%v:%v", k, v))
+			return true
+		})
+		if s := strings.Join(act, " "); s != test.exp {
+			t.Errorf("unexpected %s side: %q; want %q", test.name, s, test.exp)
+		}
+		if n := len(act); m.Size() != n || test.side.Size() != n {
+			t.Errorf("unexpected %s size: %d; want %d", test.name, test.side.Size(), n)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package avl
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for _, size := range []int{0, 1, 2, 3, 10, 100, 1000} {
+		t.Run(fmt.Sprintf("%d", size), func(t *testing.T) {
+			var (
+				a = NewMerkle(crypto.SHA256, intCodec{})
+				b = NewMerkle(crypto.SHA256, intCodec{})
+			)
+			for _, x := range rnd.Perm(size) {
+				a, _ = a.Insert(IntItem(x))
+			}
+			// Let b have the same items but different history.
+			for _, x := range rnd.Perm(size * 2) {
+				b, _ = b.Insert(IntItem(x))
+			}
+			for x := size; x < size*2; x++ {
+				b, _ = b.Delete(IntItem(x))
+			}
+			a, b = a.Canonical(), b.Canonical()
+
+			if act, exp := a.Size(), size; act != exp {
+				t.Fatalf("unexpected size: %d; want %d", act, exp)
+			}
+			assertBalanced(t, a.root)
+			assertInOrder(t, a.root, makeRange(0, size))
+			if act, exp := preOrder(a), preOrder(b); fmt.Sprint(act) != fmt.Sprint(exp) {
+				t.Fatalf("pre-order traversals differ:\n%v\n%v", act, exp)
+			}
+			if !bytes.Equal(a.RootHash(), b.RootHash()) {
+				t.Fatalf("root hashes differ")
+			}
+			if act, exp := a.RootHash(), fullDigest(a.merkle, a.root); !bytes.Equal(act, exp) {
+				t.Fatalf("unexpected root hash")
+			}
+		})
+	}
+}
+
+func preOrder(t Tree) (xs []Item) {
+	t.PreOrder(func(x Item) bool {
+		xs = append(xs, x)
+		return true
+	})
+	return xs
+}
+
+// assertBalanced checks that heights of n's subtrees are correct and differ
+// at most by one.
+func assertBalanced(t *testing.T, n *node) int {
+	t.Helper()
+	if n == nil {
+		return 0
+	}
+	l := assertBalanced(t, n.left)
+	r := assertBalanced(t, n.right)
+	if d := r - l; d < -1 || d > 1 {
+		t.Fatalf("unbalanced node %v: %d", n.value, d)
+	}
+	if h := max(l, r) + 1; n.height() != h {
+		t.Fatalf("unexpected height of node %v: %d; want %d", n.value, n.h, h)
+	}
+	return n.height()
+}
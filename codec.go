@@ -0,0 +1,12 @@
+package avl
+
+// ItemCodec encodes and decodes items to and from their binary
+// representation. It is used by the parts of the package which keep tree
+// items outside of memory.
+//
+// Note that DecodeItem() must not retain the given byte slice after return,
+// since its contents may be reused or even unmapped later.
+type ItemCodec interface {
+	EncodeItem(Item) ([]byte, error)
+	DecodeItem([]byte) (Item, error)
+}
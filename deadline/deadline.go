@@ -0,0 +1,220 @@
+/*
+Package deadline implements a queue of timers ordered by their deadlines.
+
+Timers are stored as (deadline, sequence number) items in an immutable AVL
+tree, which makes scheduling and cancellation O(log n) and lets the queue to
+be inspected without blocking the updates.
+*/
+package deadline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gobwas/avl"
+)
+
+// Clock provides the current time and timers. It can be replaced in tests.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event timer created by Clock.
+type Timer interface {
+	// C returns the channel receiving the time when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing.
+	Stop() bool
+}
+
+// Handle identifies a scheduled timer.
+type Handle struct {
+	at  time.Time
+	seq uint64
+}
+
+// Deadline returns the deadline of the timer.
+func (h Handle) Deadline() time.Time {
+	return h.at
+}
+
+// Timers is a queue of timers. It is safe for concurrent use.
+type Timers struct {
+	clock Clock
+	wake  chan struct{}
+
+	mu   sync.Mutex
+	tree avl.Tree
+	seq  uint64
+}
+
+// New creates a new Timers using given clock.
+// If clock is nil, the system clock is used.
+func New(clock Clock) *Timers {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &Timers{
+		clock: clock,
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Len returns the number of scheduled timers.
+func (t *Timers) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tree.Size()
+}
+
+// Schedule schedules fn to be called at given time.
+// Timers having equal deadlines fire in order of scheduling.
+func (t *Timers) Schedule(at time.Time, fn func()) Handle {
+	t.mu.Lock()
+	t.seq++
+	e := entry{
+		at:  at,
+		seq: t.seq,
+		fn:  fn,
+	}
+	t.tree, _ = t.tree.Insert(e)
+	first := t.tree.Min().(entry).seq == e.seq
+	t.mu.Unlock()
+
+	if first {
+		// Let Run() to reconsider the earliest deadline.
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+	return Handle{e.at, e.seq}
+}
+
+// Cancel cancels the timer identified by h.
+// It returns false if the timer has already expired or was cancelled.
+func (t *Timers) Cancel(h Handle) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var existed avl.Item
+	t.tree, existed = t.tree.Delete(entry{at: h.at, seq: h.seq})
+	return existed != nil
+}
+
+// Next returns the earliest deadline of scheduled timers.
+// It returns false if there are no timers.
+func (t *Timers) Next() (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	x := t.tree.Min()
+	if x == nil {
+		return time.Time{}, false
+	}
+	return x.(entry).at, true
+}
+
+// Expire removes the timers having deadline before or equal to now.
+// It returns their functions in order of deadlines without calling them.
+func (t *Timers) Expire(now time.Time) []func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Cut all expired timers off at once instead of popping them one by
+	// one; that is O(log n + k) instead of O(k log n).
+	var expired avl.Tree
+	t.tree, expired = t.tree.DeleteRange(nil, after(now))
+	fns := make([]func(), 0, expired.Size())
+	expired.InOrder(func(x avl.Item) bool {
+		fns = append(fns, x.(entry).fn)
+		return true
+	})
+	return fns
+}
+
+// Run calls functions of expired timers until ctx is done.
+// It sleeps until the earliest deadline using the clock passed to New().
+// Functions are called sequentially in Run()'s goroutine.
+func (t *Timers) Run(ctx context.Context) error {
+	for {
+		for _, fn := range t.Expire(t.clock.Now()) {
+			fn()
+		}
+		var (
+			timer Timer
+			fire  <-chan time.Time
+		)
+		if at, ok := t.Next(); ok {
+			timer = t.clock.NewTimer(at.Sub(t.clock.Now()))
+			fire = timer.C()
+		}
+		select {
+		case <-ctx.Done():
+		case <-t.wake:
+		case <-fire:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// entry is an item of timers tree.
+type entry struct {
+	at  time.Time
+	seq uint64
+	fn  func()
+}
+
+func (e entry) Compare(x avl.Item) int {
+	y := x.(entry)
+	switch {
+	case e.at.Before(y.at):
+		return -1
+	case e.at.After(y.at):
+		return 1
+	case e.seq < y.seq:
+		return -1
+	case e.seq > y.seq:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// after is a bound greater than entries having deadline before or equal to
+// given time.
+type after time.Time
+
+func (a after) Compare(x avl.Item) int {
+	if time.Time(a).Before(x.(entry).at) {
+		return -1
+	}
+	return 1
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t systemTimer) Stop() bool {
+	return t.t.Stop()
+}
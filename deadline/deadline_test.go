@@ -0,0 +1,176 @@
+package deadline
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExpire(t *testing.T) {
+	var (
+		ts    = New(nil)
+		epoch = time.Unix(0, 0)
+		fired []int
+	)
+	at := func(i int) time.Time {
+		return epoch.Add(time.Duration(i) * time.Second)
+	}
+	fire := func(i int) func() {
+		return func() { fired = append(fired, i) }
+	}
+	var hs []Handle
+	for _, i := range []int{3, 1, 2, 5, 4, 2} {
+		hs = append(hs, ts.Schedule(at(i), fire(i)))
+	}
+	if !ts.Cancel(hs[3]) {
+		t.Fatalf("Cancel() failed")
+	}
+	if ts.Cancel(hs[3]) {
+		t.Fatalf("Cancel() of cancelled timer succeeded")
+	}
+	if next, ok := ts.Next(); !ok || !next.Equal(at(1)) {
+		t.Fatalf("unexpected Next(): %v", next)
+	}
+	for _, fn := range ts.Expire(at(3)) {
+		fn()
+	}
+	if exp := []int{1, 2, 2, 3}; !equal(fired, exp) {
+		t.Fatalf("unexpected fired timers: %v; want %v", fired, exp)
+	}
+	if ts.Cancel(hs[0]) {
+		t.Fatalf("Cancel() of expired timer succeeded")
+	}
+	if n := ts.Len(); n != 1 {
+		t.Fatalf("unexpected number of timers: %d; want 1", n)
+	}
+	if next, ok := ts.Next(); !ok || !next.Equal(at(4)) {
+		t.Fatalf("unexpected Next(): %v", next)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var (
+		clock = &fakeClock{now: time.Unix(0, 0)}
+		ts    = New(clock)
+		fired = make(chan int, 10)
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ts.Run(ctx)
+	}()
+	schedule := func(d time.Duration, i int) Handle {
+		return ts.Schedule(clock.Now().Add(d), func() {
+			fired <- i
+		})
+	}
+	schedule(10*time.Second, 10)
+	h := schedule(2*time.Second, 2)
+	// Scheduling an earlier timer must wake up the driver.
+	schedule(time.Second, 1)
+	ts.Cancel(h)
+
+	clock.Advance(time.Second)
+	assertFired(t, fired, 1)
+	clock.Advance(5 * time.Second)
+	assertNotFired(t, fired)
+	clock.Advance(5 * time.Second)
+	assertFired(t, fired, 10)
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func assertFired(t *testing.T, fired <-chan int, exp int) {
+	t.Helper()
+	select {
+	case act := <-fired:
+		if act != exp {
+			t.Fatalf("unexpected fired timer: %d; want %d", act, exp)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timer %d did not fire", exp)
+	}
+}
+
+func assertNotFired(t *testing.T, fired <-chan int) {
+	t.Helper()
+	select {
+	case act := <-fired:
+		t.Fatalf("unexpected fired timer: %d", act)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{
+		at: c.now.Add(d),
+		c:  make(chan time.Time, 1),
+	}
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			timers = append(timers, t)
+			continue
+		}
+		select {
+		case t.c <- c.now:
+		default:
+		}
+	}
+	c.timers = timers
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	return true
+}
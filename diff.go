@@ -0,0 +1,203 @@
+package avl
+
+// Diff calls fn for each difference between trees a and b in order.
+//
+// For items present only in a, fn is called with x set to that item and nil
+// y; for items present only in b, fn is called with nil x and y set to that
+// item. For items which are equal in terms of Compare() but are not the same
+// values (see Equaler), both x and y are set. If fn returns false Diff stops.
+//
+// Subtrees shared by a and b are skipped without visiting. That is, when b is
+// derived from a by k modifying operations, Diff runs in O(k log n).
+func Diff(a, b Tree, fn func(x, y Item) bool) {
+	diff(a.root, b.root, sameItem, fn)
+}
+
+// Equal reports whether trees a and b hold equal items. Items equal in terms
+// of Compare() are compared with eq; if eq is nil, they are compared like in
+// Diff().
+//
+// Subtrees shared by a and b are skipped without visiting, which makes
+// comparison of adjacent versions of a tree nearly free.
+func Equal(a, b Tree, eq func(x, y Item) bool) bool {
+	if a.size != b.size {
+		return false
+	}
+	if eq == nil {
+		eq = sameItem
+	}
+	equal := true
+	diff(a.root, b.root, eq, func(x, y Item) bool {
+		equal = false
+		return false
+	})
+	return equal
+}
+
+// IsSubset reports whether each item of a has an item equal in terms of
+// Compare() in b. Subtrees shared by a and b are skipped without visiting.
+func IsSubset(a, b Tree) bool {
+	if a.size > b.size {
+		return false
+	}
+	subset := true
+	diff(a.root, b.root, anyItem, func(x, y Item) bool {
+		if y == nil {
+			subset = false
+		}
+		return subset
+	})
+	return subset
+}
+
+// Disjoint reports whether trees a and b have no items equal in terms of
+// Compare().
+func Disjoint(a, b Tree) bool {
+	disjoint := true
+	diff(a.root, b.root, nil, func(x, y Item) bool {
+		if x != nil && y != nil {
+			disjoint = false
+		}
+		return disjoint
+	})
+	return disjoint
+}
+
+// diff calls fn for each difference between trees a and b in order. Items
+// equal in terms of Compare() are considered different if same returns false
+// for them.
+//
+// If same is nil, all items equal in terms of Compare() are considered
+// different and shared subtrees are not skipped.
+func diff(a, b *node, same func(x, y Item) bool, fn func(x, y Item) bool) {
+	var (
+		ca = newDiffCursor(a)
+		cb = newDiffCursor(b)
+	)
+	for {
+		ha, hb := ca.head(), cb.head()
+		switch {
+		case ha == nil && hb == nil:
+			return
+
+		case ha != nil && hb != nil && ha.whole && hb.whole:
+			switch {
+			case ha.n == hb.n && same != nil:
+				// Shared subtree.
+				ca.pop()
+				cb.pop()
+			case ha.n.h >= hb.n.h:
+				ca.expand()
+			default:
+				cb.expand()
+			}
+
+		case ha != nil && ha.whole:
+			ca.expand()
+
+		case hb != nil && hb.whole:
+			cb.expand()
+
+		case hb == nil:
+			if !fn(ha.n.value, nil) {
+				return
+			}
+			ca.pop()
+
+		case ha == nil:
+			if !fn(nil, hb.n.value) {
+				return
+			}
+			cb.pop()
+
+		default:
+			var (
+				x, y   = ha.n.value, hb.n.value
+				shared = ha.n == hb.n && same != nil
+				cmp    = x.Compare(y)
+			)
+			switch {
+			case cmp < 0:
+				y = nil
+				ca.pop()
+			case cmp > 0:
+				x = nil
+				cb.pop()
+			default:
+				ca.pop()
+				cb.pop()
+				if shared || (same != nil && same(x, y)) {
+					continue
+				}
+			}
+			if !fn(x, y) {
+				return
+			}
+		}
+	}
+}
+
+// diffCursor holds the in-order position in a tree. Its stack holds pending
+// entries: whole subtrees which were not visited yet or single nodes whose
+// left subtrees are already visited.
+type diffCursor struct {
+	stack []diffEntry
+}
+
+type diffEntry struct {
+	n     *node
+	whole bool
+}
+
+func newDiffCursor(root *node) *diffCursor {
+	c := new(diffCursor)
+	if root != nil {
+		c.stack = append(c.stack, diffEntry{root, true})
+	}
+	return c
+}
+
+func (c *diffCursor) head() *diffEntry {
+	if len(c.stack) == 0 {
+		return nil
+	}
+	return &c.stack[len(c.stack)-1]
+}
+
+func (c *diffCursor) pop() {
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+// expand replaces the whole subtree at the head with its right subtree, its
+// root node and its left subtree.
+func (c *diffCursor) expand() {
+	n := c.head().n
+	c.pop()
+	if n.right != nil {
+		c.stack = append(c.stack, diffEntry{n.right, true})
+	}
+	c.stack = append(c.stack, diffEntry{n, false})
+	if n.left != nil {
+		c.stack = append(c.stack, diffEntry{n.left, true})
+	}
+}
+
+// sameItem reports whether x and y are the same values. Items implementing
+// Equaler are compared with Equal(); items of non-comparable types are never
+// the same.
+func sameItem(x, y Item) (same bool) {
+	if _, ok := x.(Equaler); ok {
+		return equalItems(x, y)
+	}
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	return x == y
+}
+
+// anyItem reports that any items are the same.
+func anyItem(x, y Item) bool {
+	return true
+}
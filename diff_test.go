@@ -0,0 +1,214 @@
+package avl
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	var a Tree
+	for i := 0; i < 1000; i++ {
+		a, _ = a.Insert(IntItem(rnd.Intn(2000)))
+	}
+	for i := 0; i < 100; i++ {
+		b := a
+		for j := rnd.Intn(50); j >= 0; j-- {
+			x := IntItem(rnd.Intn(2000))
+			switch rnd.Intn(3) {
+			case 0:
+				b, _ = b.Insert(x)
+			case 1:
+				b, _ = b.Update(x)
+			case 2:
+				b, _ = b.Delete(x)
+			}
+		}
+		var act []string
+		Diff(a, b, func(x, y Item) bool {
+			act = append(act, fmt.Sprintf("%v->%v", x, y))
+			return true
+		})
+		if exp := naiveDiff(a, b); fmt.Sprint(act) != fmt.Sprint(exp) {
+			t.Fatalf("unexpected diff:\n%v\nwant:\n%v", act, exp)
+		}
+		a = b
+	}
+}
+
+func TestDiffShared(t *testing.T) {
+	var a Tree
+	for i := 0; i < 1<<14; i++ {
+		a, _ = a.Insert(IntItem(i))
+	}
+	b, _ := a.Insert(IntItem(-1))
+	b, _ = b.Delete(IntItem(100))
+
+	var (
+		n    int
+		diff []string
+	)
+	// Wrap items to count comparisons made while diffing.
+	cs := countCompare(&n, a, b)
+	Diff(cs[0], cs[1], func(x, y Item) bool {
+		diff = append(diff, fmt.Sprintf("%v->%v", x, y))
+		return true
+	})
+	if exp := []string{"<nil>->-1", "100-><nil>"}; fmt.Sprint(diff) != fmt.Sprint(exp) {
+		t.Fatalf("unexpected diff: %v; want %v", diff, exp)
+	}
+	if n > 200 {
+		t.Fatalf("too many comparisons: %d", n)
+	}
+}
+
+func naiveDiff(a, b Tree) (ret []string) {
+	var xs, ys []Item
+	a.InOrder(func(x Item) bool { xs = append(xs, x); return true })
+	b.InOrder(func(y Item) bool { ys = append(ys, y); return true })
+	for len(xs) > 0 || len(ys) > 0 {
+		switch {
+		case len(ys) == 0 || (len(xs) > 0 && xs[0].Compare(ys[0]) < 0):
+			ret, xs = append(ret, fmt.Sprintf("%v-><nil>", xs[0])), xs[1:]
+		case len(xs) == 0 || xs[0].Compare(ys[0]) > 0:
+			ret, ys = append(ret, fmt.Sprintf("<nil>->%v", ys[0])), ys[1:]
+		default:
+			xs, ys = xs[1:], ys[1:]
+		}
+	}
+	return ret
+}
+
+// countCompare returns copies of given trees having the same shape and
+// sharing nodes in the same way, whose items count their comparisons in cnt.
+func countCompare(cnt *int, ts ...Tree) []Tree {
+	seen := make(map[*node]*node)
+	var walk func(*node) *node
+	walk = func(n *node) *node {
+		if n == nil {
+			return nil
+		}
+		if m, ok := seen[n]; ok {
+			return m
+		}
+		m := &node{
+			value: countingItem{n.value.(IntItem), cnt},
+			left:  walk(n.left),
+			right: walk(n.right),
+			h:     n.h,
+		}
+		seen[n] = m
+		return m
+	}
+	ret := make([]Tree, len(ts))
+	for i, t := range ts {
+		t.root = walk(t.root)
+		ret[i] = t
+	}
+	return ret
+}
+
+type countingItem struct {
+	IntItem
+	n *int
+}
+
+func (c countingItem) Compare(x Item) int {
+	*c.n++
+	return int(c.IntItem) - int(x.(countingItem).IntItem)
+}
+
+func TestEqualSubsetDisjoint(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		a, b     []int
+		equal    bool
+		subset   bool
+		disjoint bool
+	}{
+		{
+			name:   "empty",
+			equal:  true,
+			subset: true,
+			// Empty sets are disjoint.
+			disjoint: true,
+		},
+		{
+			name:     "empty subset",
+			b:        makeRange(0, 10),
+			subset:   true,
+			disjoint: true,
+		},
+		{
+			name:   "equal",
+			a:      makeRange(0, 10),
+			b:      makeRange(0, 10),
+			equal:  true,
+			subset: true,
+		},
+		{
+			name:   "subset",
+			a:      makeRange(3, 7),
+			b:      makeRange(0, 10),
+			subset: true,
+		},
+		{
+			name: "superset",
+			a:    makeRange(0, 10),
+			b:    makeRange(3, 7),
+		},
+		{
+			name: "overlapping",
+			a:    makeRange(0, 10),
+			b:    makeRange(5, 15),
+		},
+		{
+			name:     "disjoint",
+			a:        makeRange(0, 10),
+			b:        makeRange(10, 20),
+			disjoint: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a := buildTreeFrom(test.a...)
+			b := buildTreeFrom(test.b...)
+			if act := Equal(a, b, nil); act != test.equal {
+				t.Errorf("unexpected Equal(): %t; want %t", act, test.equal)
+			}
+			if act := IsSubset(a, b); act != test.subset {
+				t.Errorf("unexpected IsSubset(): %t; want %t", act, test.subset)
+			}
+			if act := Disjoint(a, b); act != test.disjoint {
+				t.Errorf("unexpected Disjoint(): %t; want %t", act, test.disjoint)
+			}
+		})
+	}
+}
+
+func TestEqualShared(t *testing.T) {
+	var a Tree
+	for i := 0; i < 1<<14; i++ {
+		a, _ = a.Insert(pair{i, i})
+	}
+	b, _ := a.Update(pair{100, -1})
+	c, _ := b.Update(pair{100, 100})
+
+	var n int
+	eq := func(x, y Item) bool {
+		n++
+		return x.(pair).value == y.(pair).value
+	}
+	if Equal(a, b, eq) {
+		t.Fatalf("trees with different values are equal")
+	}
+	if !Equal(a, c, eq) {
+		t.Fatalf("trees with equal values are not equal")
+	}
+	if !IsSubset(b, c) || Disjoint(b, c) {
+		t.Fatalf("unexpected relation between versions")
+	}
+	if n > 100 {
+		t.Fatalf("too many comparisons: %d", n)
+	}
+}
@@ -53,5 +53,8 @@ blocking while update operation is in progress:
 
 Note that usually there is a need to use second mutex to serialize tree updates
 across multiple writer goroutines.
+
+Instead of polling the tree state, readers could subscribe to its changes
+using the watch package.
 */
 package avl
@@ -0,0 +1,519 @@
+package avl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	recordInsert byte = 3
+	recordUpdate byte = 4
+	recordDelete byte = 5
+	recordItem   byte = 6
+	recordEnd    byte = 7
+)
+
+const (
+	walPrefix      = "wal-"
+	snapshotPrefix = "snapshot-"
+)
+
+// SyncPolicy defines when Durable syncs its write-ahead log to disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs the log after each modification.
+	SyncAlways SyncPolicy = iota
+
+	// SyncPeriodic syncs the log periodically in background. That is, last
+	// modifications may be lost if the machine crashes.
+	SyncPeriodic
+
+	// SyncNever leaves syncing to the operating system. Note that the log is
+	// still written before each modification is applied, so modifications
+	// survive crash of the process itself.
+	SyncNever
+)
+
+// DurableOptions holds parameters of Durable. Nil *DurableOptions means
+// defaults.
+type DurableOptions struct {
+	// Sync is the policy of syncing the log. Default is SyncAlways.
+	Sync SyncPolicy
+
+	// SyncInterval is the interval between syncs for SyncPeriodic policy.
+	// If zero, the default of one second is used.
+	SyncInterval time.Duration
+
+	// SnapshotEvery is the number of log records after which a snapshot of
+	// the tree is written and the log is truncated. If zero, the default of
+	// 10000 is used. Negative value disables automatic snapshots.
+	//
+	// Errors of automatic snapshots are not reported; the snapshot is
+	// retried after each next modification. Use Snapshot() to handle them.
+	SnapshotEvery int
+}
+
+func (opts *DurableOptions) withDefaults() DurableOptions {
+	var o DurableOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.SyncInterval <= 0 {
+		o.SyncInterval = time.Second
+	}
+	if o.SnapshotEvery == 0 {
+		o.SnapshotEvery = 10000
+	}
+	return o
+}
+
+// Durable holds a Tree whose modifications survive process crashes.
+//
+// Each modification is appended to the write-ahead log before it becomes
+// visible. Periodically the whole tree is written to a snapshot file and the
+// log is started over. On open, the latest snapshot is loaded and the log
+// written after it is replayed.
+//
+// Durable is safe for concurrent use. Readers may get the current tree with
+// Tree() and use it without any locking.
+type Durable struct {
+	dir   string
+	codec ItemCodec
+	opts  DurableOptions
+
+	mu      sync.RWMutex
+	tree    Tree
+	seq     uint64
+	file    *os.File
+	w       *bufio.Writer
+	records int
+	err     error
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenDurable opens a durable tree stored in dir, creating it if necessary.
+// Items are encoded and decoded with given codec.
+//
+// If the log ends with a torn record left after a crash in the middle of
+// write, the record is ignored and truncated. A damaged record followed by
+// valid ones is reported as an error and the log is left as is.
+func OpenDurable(dir string, codec ItemCodec, opts *DurableOptions) (*Durable, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	d := &Durable{
+		dir:   dir,
+		codec: codec,
+		opts:  opts.withDefaults(),
+	}
+	if err := d.recover(); err != nil {
+		return nil, err
+	}
+	if d.opts.Sync == SyncPeriodic {
+		d.stop = make(chan struct{})
+		d.done = make(chan struct{})
+		go d.syncer()
+	}
+	return d, nil
+}
+
+func (d *Durable) recover() error {
+	snapshots, err := d.files(snapshotPrefix)
+	if err != nil {
+		return err
+	}
+	// Use the latest valid snapshot. Note that snapshots are written
+	// atomically, so broken snapshot could only be the result of disk
+	// failure.
+	var loaded bool
+	for i := len(snapshots) - 1; i >= 0 && !loaded; i-- {
+		seq := snapshots[i]
+		t, err := d.readSnapshot(d.path(snapshotPrefix, seq))
+		if err != nil {
+			continue
+		}
+		d.tree, d.seq, loaded = t, seq, true
+	}
+	if !loaded && len(snapshots) > 0 {
+		return fmt.Errorf("avl: no valid snapshot in %s", d.dir)
+	}
+	if err := d.replay(); err != nil {
+		return err
+	}
+	d.removeBefore(d.seq)
+	return nil
+}
+
+// files returns sorted sequence numbers of files having given prefix.
+func (d *Durable) files(prefix string) ([]uint64, error) {
+	names, err := filepath.Glob(filepath.Join(d.dir, prefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, name := range names {
+		s := strings.TrimPrefix(filepath.Base(name), prefix)
+		seq, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+	return seqs, nil
+}
+
+func (d *Durable) path(prefix string, seq uint64) string {
+	return filepath.Join(d.dir, fmt.Sprintf("%s%020d", prefix, seq))
+}
+
+func (d *Durable) readSnapshot(path string) (t Tree, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return t, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		kind, p, _, err := readRecord(r)
+		if err != nil {
+			return t, err
+		}
+		switch kind {
+		case recordItem:
+			x, err := d.codec.DecodeItem(p)
+			if err != nil {
+				return t, err
+			}
+			t, _ = t.Insert(x)
+
+		case recordEnd:
+			return t, nil
+
+		default:
+			return t, errCorruptedRecord
+		}
+	}
+}
+
+// replay applies records of the current log to the tree and opens the log
+// for appending.
+func (d *Durable) replay() error {
+	path := d.path(walPrefix, d.seq)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	var (
+		r   = bufio.NewReader(file)
+		end int64
+	)
+	for {
+		kind, p, n, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if tornRecord(err, file, end, info.Size()) {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("avl: replay %s at offset %d: %w", path, end, err)
+		}
+		if err := d.apply(kind, p); err != nil {
+			file.Close()
+			return fmt.Errorf("avl: replay %s: %w", path, err)
+		}
+		end += n
+		d.records++
+	}
+	if err := file.Truncate(end); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	d.file = file
+	d.w = bufio.NewWriter(file)
+	return nil
+}
+
+func (d *Durable) apply(kind byte, p []byte) error {
+	x, err := d.codec.DecodeItem(p)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case recordInsert:
+		d.tree, _ = d.tree.Insert(x)
+	case recordUpdate:
+		d.tree, _ = d.tree.Update(x)
+	case recordDelete:
+		d.tree, _ = d.tree.Delete(x)
+	default:
+		return errCorruptedRecord
+	}
+	return nil
+}
+
+// Tree returns the current state of the tree.
+func (d *Durable) Tree() Tree {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.tree
+}
+
+// Insert inserts x in the tree. It returns already existing item, which
+// non-nil value means that x was not inserted.
+func (d *Durable) Insert(x Item) (existing Item, err error) {
+	err = d.modify(recordInsert, x, func(t Tree) (Tree, bool) {
+		t, existing = t.Insert(x)
+		return t, existing == nil
+	})
+	return existing, err
+}
+
+// Update inserts x in the tree or replaces already existing item with it.
+// It returns replaced item if any.
+func (d *Durable) Update(x Item) (prev Item, err error) {
+	err = d.modify(recordUpdate, x, func(t Tree) (Tree, bool) {
+		t, prev = t.Update(x)
+		return t, true
+	})
+	return prev, err
+}
+
+// Delete deletes x from the tree. It returns deleted item if any.
+func (d *Durable) Delete(x Item) (existed Item, err error) {
+	err = d.modify(recordDelete, x, func(t Tree) (Tree, bool) {
+		t, existed = t.Delete(x)
+		return t, existed != nil
+	})
+	return existed, err
+}
+
+func (d *Durable) modify(kind byte, x Item, fn func(Tree) (Tree, bool)) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrStoreClosed
+	}
+	if d.err != nil {
+		return d.err
+	}
+	t, changed := fn(d.tree)
+	if !changed {
+		return nil
+	}
+	p, err := d.codec.EncodeItem(x)
+	if err != nil {
+		return err
+	}
+	if _, err := writeRecord(d.w, kind, p); err != nil {
+		return d.fail(err)
+	}
+	if err := d.w.Flush(); err != nil {
+		return d.fail(err)
+	}
+	if d.opts.Sync == SyncAlways {
+		if err := d.file.Sync(); err != nil {
+			return d.fail(err)
+		}
+	}
+	d.tree = t
+	d.records++
+
+	if n := d.opts.SnapshotEvery; n > 0 && d.records >= n {
+		// The modification is already durable, so don't report it as
+		// failed. Failed snapshot leaves the current log in use; it is
+		// retried after the next modification.
+		d.snapshot()
+	}
+	return nil
+}
+
+// fail makes Durable unusable after an error which left the log in unknown
+// state. It must be called with d.mu held.
+func (d *Durable) fail(err error) error {
+	d.err = err
+	return err
+}
+
+// Snapshot writes current state of the tree to a snapshot file and starts a
+// new log.
+func (d *Durable) Snapshot() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrStoreClosed
+	}
+	return d.snapshot()
+}
+
+func (d *Durable) snapshot() error {
+	// Create the next log before the snapshot appears. Otherwise, if the log
+	// could not be created, modifications would continue to go to the
+	// current log, which is ignored on recovery once the snapshot exists.
+	seq := d.seq + 1
+	wal := d.path(walPrefix, seq)
+	file, err := os.OpenFile(wal, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err == nil {
+		err = file.Sync()
+		if err != nil {
+			file.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := d.writeSnapshot(d.path(snapshotPrefix, seq)); err != nil {
+		file.Close()
+		os.Remove(wal)
+		return err
+	}
+	d.closeLog()
+	d.file = file
+	d.w = bufio.NewWriter(file)
+	d.seq = seq
+	d.records = 0
+	d.removeBefore(seq)
+
+	return nil
+}
+
+func (d *Durable) writeSnapshot(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	d.tree.InOrder(func(x Item) bool {
+		var p []byte
+		if p, err = d.codec.EncodeItem(x); err != nil {
+			return false
+		}
+		_, err = writeRecord(w, recordItem, p)
+		return err == nil
+	})
+	if err == nil {
+		p := appendUvarint(nil, uint64(d.tree.Size()))
+		_, err = writeRecord(w, recordEnd, p)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// removeBefore removes snapshots and logs older than seq.
+func (d *Durable) removeBefore(seq uint64) {
+	for _, prefix := range []string{snapshotPrefix, walPrefix} {
+		seqs, _ := d.files(prefix)
+		for _, s := range seqs {
+			if s < seq {
+				os.Remove(d.path(prefix, s))
+			}
+		}
+	}
+}
+
+// Sync syncs the log to disk.
+func (d *Durable) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrStoreClosed
+	}
+	return d.file.Sync()
+}
+
+// Close syncs and closes the log.
+func (d *Durable) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return ErrStoreClosed
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	if d.stop != nil {
+		close(d.stop)
+		<-d.done
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.closeLog()
+}
+
+func (d *Durable) closeLog() error {
+	err := d.w.Flush()
+	if err == nil {
+		err = d.file.Sync()
+	}
+	if cerr := d.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (d *Durable) syncer() {
+	defer close(d.done)
+
+	tick := time.NewTicker(d.opts.SyncInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			d.mu.Lock()
+			if !d.closed && d.err == nil {
+				if err := d.file.Sync(); err != nil {
+					d.err = err
+				}
+			}
+			d.mu.Unlock()
+
+		case <-d.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package avl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDurableRecover(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts *DurableOptions
+	}{
+		{
+			name: "log only",
+			opts: &DurableOptions{SnapshotEvery: -1},
+		},
+		{
+			name: "snapshots",
+			opts: &DurableOptions{SnapshotEvery: 7},
+		},
+		{
+			name: "no sync",
+			opts: &DurableOptions{Sync: SyncNever, SnapshotEvery: 5},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			d, err := OpenDurable(dir, intCodec{}, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 20; i++ {
+				if _, err := d.Insert(IntItem(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 20; i += 2 {
+				if _, err := d.Delete(IntItem(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := d.Update(IntItem(100)); err != nil {
+				t.Fatal(err)
+			}
+			exp := []int{1, 3, 5, 7, 9, 11, 13, 15, 17, 19, 100}
+			assertInOrder(t, d.Tree().root, exp)
+			if err := d.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			d, err = OpenDurable(dir, intCodec{}, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+
+			tree := d.Tree()
+			if act, exp := tree.Size(), len(exp); act != exp {
+				t.Errorf("unexpected size: %d; want %d", act, exp)
+			}
+			assertInOrder(t, tree.root, exp)
+		})
+	}
+}
+
+func TestDurableTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	d, err := OpenDurable(dir, intCodec{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := d.Insert(IntItem(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Close()
+
+	logs, _ := filepath.Glob(filepath.Join(dir, walPrefix+"*"))
+	if len(logs) != 1 {
+		t.Fatalf("unexpected log files: %v", logs)
+	}
+	info, err := os.Stat(logs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(logs[0], info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = OpenDurable(dir, intCodec{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInOrder(t, d.Tree().root, []int{0, 1})
+
+	if _, err := d.Insert(IntItem(5)); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	d, err = OpenDurable(dir, intCodec{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	assertInOrder(t, d.Tree().root, []int{0, 1, 5})
+}
+
+func TestDurableCorruptedRecord(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		off  int64 // Offset of corrupted byte from the end of the log.
+		set  byte  // Value of corrupted byte; if zero, the byte is inverted.
+		err  bool
+		exp  []int
+	}{
+		{
+			name: "last",
+			off:  1,
+			exp:  []int{0, 1},
+		},
+		{
+			name: "middle",
+			// Each record takes 7 bytes: kind, size, item and checksum.
+			off: 8,
+			err: true,
+		},
+		{
+			name: "size",
+			// Make the first record run past the end of the log.
+			off: 20,
+			set: 0x7f,
+			err: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			d, err := OpenDurable(dir, intCodec{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				if _, err := d.Insert(IntItem(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			d.Close()
+
+			logs, _ := filepath.Glob(filepath.Join(dir, walPrefix+"*"))
+			data, err := ioutil.ReadFile(logs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i := int64(len(data)) - test.off; test.set != 0 {
+				data[i] = test.set
+			} else {
+				data[i] ^= 0xff
+			}
+			if err := ioutil.WriteFile(logs[0], data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			d, err = OpenDurable(dir, intCodec{}, nil)
+			if test.err {
+				if err == nil {
+					d.Close()
+					t.Fatalf("expected error")
+				}
+				// Valid records must not be dropped.
+				info, err := os.Stat(logs[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Size() != int64(len(data)) {
+					t.Fatalf("log is truncated")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			assertInOrder(t, d.Tree().root, test.exp)
+		})
+	}
+}
+
+func TestDurableSnapshotError(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		prefix string
+	}{
+		{"log", walPrefix},
+		{"snapshot", snapshotPrefix},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := &DurableOptions{SnapshotEvery: -1}
+			d, err := OpenDurable(dir, intCodec{}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.Insert(IntItem(0)); err != nil {
+				t.Fatal(err)
+			}
+			// Make the file of the next snapshot or log impossible to
+			// create for a while.
+			block := d.path(test.prefix, 1)
+			if err := os.MkdirAll(filepath.Join(block, "x"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.Snapshot(); err == nil {
+				t.Fatalf("expected snapshot error")
+			}
+			for i := 1; i < 4; i++ {
+				if _, err := d.Insert(IntItem(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := d.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.RemoveAll(block); err != nil {
+				t.Fatal(err)
+			}
+
+			d, err = OpenDurable(dir, intCodec{}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			assertInOrder(t, d.Tree().root, []int{0, 1, 2, 3})
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package avl
+
+import "container/heap"
+
+// Iterator is an in-order cursor over values of a tree.
+//
+// It holds the path to the next value, thus Next() runs in O(1) amortized
+// time and Seek() runs in O(log n). Since trees are immutable, the iterator
+// is not affected by modifications of the tree it was created from.
+type Iterator struct {
+	root  *node
+	stack []*node
+	item  Item
+}
+
+// Iter returns an iterator positioned before the min value of the tree.
+func (t Tree) Iter() *Iterator {
+	it := &Iterator{
+		root: t.root,
+	}
+	it.Seek(nil)
+	return it
+}
+
+// Seek positions the iterator before the least value greater than or equal
+// to x. Nil x means the min value of the tree.
+func (it *Iterator) Seek(x Item) {
+	it.stack = it.stack[:0]
+	it.item = nil
+	for n := it.root; n != nil; {
+		if x == nil || x.Compare(n.value) <= 0 {
+			it.stack = append(it.stack, n)
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+}
+
+// Next advances the iterator to the next value.
+// It returns false if there are no more values.
+func (it *Iterator) Next() bool {
+	if len(it.stack) == 0 {
+		it.item = nil
+		return false
+	}
+	n := it.stack[len(it.stack)-1]
+	it.stack = it.stack[:len(it.stack)-1]
+	for m := n.right; m != nil; m = m.left {
+		it.stack = append(it.stack, m)
+	}
+	it.item = n.value
+	return true
+}
+
+// Item returns the current value of the iterator. It returns nil if Next()
+// was not called or returned false.
+func (it *Iterator) Item() Item {
+	return it.item
+}
+
+// TiePolicy defines which items MergeIterator yields when several trees hold
+// equal items.
+type TiePolicy int
+
+const (
+	// TieAll yields all equal items in order of trees.
+	TieAll TiePolicy = iota
+
+	// TieFirst yields only the item of the first tree.
+	TieFirst
+
+	// TieLast yields only the item of the last tree.
+	TieLast
+)
+
+// MergeIterator yields values of several trees in global order.
+type MergeIterator struct {
+	policy TiePolicy
+	heap   mergeHeap
+	item   Item
+	source int
+}
+
+// MergeIter returns an iterator over values of given trees in global order.
+// Equal values held by several trees are yielded according to policy.
+//
+// The time complexity of each step is O(log k), where k is the number of
+// trees.
+func MergeIter(policy TiePolicy, trees ...Tree) *MergeIterator {
+	m := &MergeIterator{
+		policy: policy,
+	}
+	for i, t := range trees {
+		it := t.Iter()
+		if it.Next() {
+			m.heap = append(m.heap, mergeHead{it, i})
+		}
+	}
+	heap.Init(&m.heap)
+	return m
+}
+
+// Next advances the iterator to the next value.
+// It returns false if there are no more values.
+func (m *MergeIterator) Next() bool {
+	if len(m.heap) == 0 {
+		m.item = nil
+		return false
+	}
+	m.item, m.source = m.heap[0].it.Item(), m.heap[0].source
+	m.advance()
+	if m.policy == TieAll {
+		return true
+	}
+	for len(m.heap) > 0 && m.item.Compare(m.heap[0].it.Item()) == 0 {
+		if m.policy == TieLast {
+			m.item, m.source = m.heap[0].it.Item(), m.heap[0].source
+		}
+		m.advance()
+	}
+	return true
+}
+
+// advance advances the iterator at the top of the heap.
+func (m *MergeIterator) advance() {
+	if m.heap[0].it.Next() {
+		heap.Fix(&m.heap, 0)
+	} else {
+		heap.Pop(&m.heap)
+	}
+}
+
+// Item returns the current value of the iterator. It returns nil if Next()
+// was not called or returned false.
+func (m *MergeIterator) Item() Item {
+	return m.item
+}
+
+// Source returns the index of the tree holding the current value.
+func (m *MergeIterator) Source() int {
+	return m.source
+}
+
+type mergeHead struct {
+	it     *Iterator
+	source int
+}
+
+type mergeHeap []mergeHead
+
+func (h mergeHeap) Len() int {
+	return len(h)
+}
+
+func (h mergeHeap) Less(i, j int) bool {
+	cmp := h[i].it.Item().Compare(h[j].it.Item())
+	if cmp == 0 {
+		return h[i].source < h[j].source
+	}
+	return cmp < 0
+}
+
+func (h mergeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *mergeHeap) Push(x interface{}) {
+	*h = append(*h, x.(mergeHead))
+}
+
+func (h *mergeHeap) Pop() interface{} {
+	x := (*h)[len(*h)-1]
+	*h = (*h)[:len(*h)-1]
+	return x
+}
+
+// JoinIterator yields pairs of values of two trees joined by equality in
+// terms of Compare().
+type JoinIterator struct {
+	a, b        *Iterator
+	okA, okB    bool
+	left, right Item
+}
+
+// JoinIter returns an iterator over values of trees a and b in global order.
+// Equal values are yielded as a single pair; values present only in one of
+// the trees are yielded with nil counterpart.
+func JoinIter(a, b Tree) *JoinIterator {
+	j := &JoinIterator{
+		a: a.Iter(),
+		b: b.Iter(),
+	}
+	j.okA = j.a.Next()
+	j.okB = j.b.Next()
+	return j
+}
+
+// Next advances the iterator to the next pair.
+// It returns false if there are no more pairs.
+func (j *JoinIterator) Next() bool {
+	j.left, j.right = nil, nil
+	switch {
+	case !j.okA && !j.okB:
+		return false
+	case !j.okB:
+		j.left = j.a.Item()
+	case !j.okA:
+		j.right = j.b.Item()
+	default:
+		cmp := j.a.Item().Compare(j.b.Item())
+		if cmp <= 0 {
+			j.left = j.a.Item()
+		}
+		if cmp >= 0 {
+			j.right = j.b.Item()
+		}
+	}
+	if j.left != nil {
+		j.okA = j.a.Next()
+	}
+	if j.right != nil {
+		j.okB = j.b.Next()
+	}
+	return true
+}
+
+// Left returns the value of the first tree in the current pair or nil.
+func (j *JoinIterator) Left() Item {
+	return j.left
+}
+
+// Right returns the value of the second tree in the current pair or nil.
+func (j *JoinIterator) Right() Item {
+	return j.right
+}
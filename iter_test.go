@@ -0,0 +1,86 @@
+package avl
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 10, 100} {
+		xs := makeRange(0, n)
+		tree := buildTreeFrom(xs...)
+		it := tree.Iter()
+		assertOrder(t, fmt.Sprintf("iter %d", n), xs, func(fn func(Item) bool) bool {
+			for it.Next() {
+				if !fn(it.Item()) {
+					return false
+				}
+			}
+			return true
+		})
+		if it.Next() || it.Item() != nil {
+			t.Fatalf("unexpected item after the end: %v", it.Item())
+		}
+		for x := -1; x <= n; x++ {
+			it.Seek(IntItem(x))
+			exp := makeRange(x, n)
+			if x < 0 {
+				exp = xs
+			}
+			assertOrder(t, fmt.Sprintf("seek %d/%d", x, n), exp, func(fn func(Item) bool) bool {
+				for it.Next() {
+					if !fn(it.Item()) {
+						return false
+					}
+				}
+				return true
+			})
+		}
+	}
+}
+
+func TestMergeIter(t *testing.T) {
+	var (
+		a = buildTreeFrom(1, 3, 5, 7)
+		b = buildTreeFrom(2, 3, 6, 7)
+		c = buildTreeFrom(0, 7, 8)
+	)
+	for _, test := range []struct {
+		policy TiePolicy
+		exp    string
+	}{
+		{TieAll, "0:3 1:0 2:1 3:0 3:1 5:0 6:1 7:0 7:1 7:3 8:3"},
+		{TieFirst, "0:3 1:0 2:1 3:0 5:0 6:1 7:0 8:3"},
+		{TieLast, "0:3 1:0 2:1 3:1 5:0 6:1 7:3 8:3"},
+	} {
+		var act []string
+		// Empty tree at index 2 must be skipped.
+		m := MergeIter(test.policy, a, b, Tree{}, c)
+		for m.Next() {
+			act = append(act, fmt.Sprintf("%v:%d", m.Item(), m.Source()))
+		}
+		if s := strings.Join(act, " "); s != test.exp {
+			t.Errorf("unexpected merge with policy %d:\n%s\nwant:\n%s", test.policy, s, test.exp)
+		}
+	}
+}
+
+func TestJoinIter(t *testing.T) {
+	var (
+		a   = buildTreeFrom(1, 2, 4, 6)
+		b   = buildTreeFrom(0, 2, 3, 6, 7)
+		act []string
+	)
+	j := JoinIter(a, b)
+	for j.Next() {
+		act = append(act, fmt.Sprintf("%v/%v", j.Left(), j.Right()))
+	}
+	exp := "<nil>/0 1/<nil> 2/2 <nil>/3 4/<nil> 6/6 <nil>/7"
+	if s := strings.Join(act, " "); s != exp {
+		t.Fatalf("unexpected join:\n%s\nwant:\n%s", s, exp)
+	}
+	if j.Next() {
+		t.Fatalf("unexpected pair after the end")
+	}
+}
@@ -0,0 +1,143 @@
+package lsm
+
+import (
+	"bytes"
+	"sort"
+)
+
+// compactOne picks a level which needs compaction and merges its tables into
+// the next level. It returns false if no level needs compaction.
+func (db *DB) compactOne() (bool, error) {
+	db.mu.Lock()
+	level, inputs := db.pickCompaction()
+	if inputs == nil {
+		db.mu.Unlock()
+		return false, nil
+	}
+	var (
+		lo, hi = keyRange(inputs)
+		next   []*table
+		last   = true
+	)
+	if level+1 < len(db.v.levels) {
+		next = overlapping(db.v.levels[level+1], lo, hi)
+	}
+	for _, tables := range db.v.levels[min(level+2, len(db.v.levels)):] {
+		if len(tables) > 0 {
+			last = false
+		}
+	}
+	db.mu.Unlock()
+
+	var iters []iterator
+	for _, t := range inputs {
+		iters = append(iters, t.r.Seek(nil))
+	}
+	iters = append(iters, &levelIter{tables: next})
+
+	tw := db.tableWriter(db.opts.TableSize)
+	it := newMergeIter(iters...)
+	var err error
+	for err == nil && it.Next() {
+		e := it.Item().(entry)
+		if e.deleted && last {
+			// There are no older values which the tombstone could shadow.
+			continue
+		}
+		err = tw.add(e)
+	}
+	if err == nil {
+		err = it.Err()
+	}
+	if err == nil {
+		err = tw.finish()
+	}
+	if err != nil {
+		tw.abort()
+		return false, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	levels := db.copyLevels()
+	if len(levels) == level+1 {
+		levels = append(levels, nil)
+	}
+	levels[level] = exclude(levels[level], inputs)
+	levels[level+1] = append(exclude(levels[level+1], next), tw.tables...)
+	sort.Slice(levels[level+1], func(i, j int) bool {
+		return bytes.Compare(levels[level+1][i].min.key, levels[level+1][j].min.key) < 0
+	})
+	db.v.levels = levels
+	if err := db.saveManifest(); err != nil {
+		return false, err
+	}
+	for _, t := range append(inputs, next...) {
+		t.obsolete = true
+		db.maybeRemove(t)
+	}
+	return true, nil
+}
+
+// pickCompaction returns the level and its tables which must be compacted.
+// It must be called with db.mu held.
+func (db *DB) pickCompaction() (level int, tables []*table) {
+	levels := db.v.levels
+	if len(levels) > 0 && len(levels[0]) >= db.opts.L0Tables {
+		return 0, levels[0]
+	}
+	limit := db.opts.LevelSize
+	for i := 1; i < len(levels); i++ {
+		var size int64
+		for _, t := range levels[i] {
+			size += t.size
+		}
+		if size > limit {
+			return i, levels[i][:1]
+		}
+		limit *= 10
+	}
+	return 0, nil
+}
+
+func keyRange(tables []*table) (lo, hi []byte) {
+	for _, t := range tables {
+		if lo == nil || bytes.Compare(t.min.key, lo) < 0 {
+			lo = t.min.key
+		}
+		if hi == nil || bytes.Compare(t.max.key, hi) > 0 {
+			hi = t.max.key
+		}
+	}
+	return lo, hi
+}
+
+func overlapping(tables []*table, lo, hi []byte) (ret []*table) {
+	for _, t := range tables {
+		if bytes.Compare(t.max.key, lo) >= 0 && bytes.Compare(t.min.key, hi) <= 0 {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+func exclude(tables, remove []*table) (ret []*table) {
+	skip := make(map[*table]bool, len(remove))
+	for _, t := range remove {
+		skip[t] = true
+	}
+	for _, t := range tables {
+		if !skip[t] {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,590 @@
+/*
+Package lsm implements a small embedded persistent key-value store based on
+log-structured merge tree.
+
+Writes are appended to the write-ahead log and applied to the memtable, which
+is an immutable avl.Tree. When memtable grows large enough it is frozen and
+replaced with an empty one; the frozen tree is flushed into a sorted table
+file in the background while reads continue to use it. Table files are
+organized in levels and are merged into deeper levels by compaction.
+*/
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gobwas/avl"
+)
+
+// ErrClosed is returned by DB methods called after Close().
+var ErrClosed = errors.New("lsm: database is closed")
+
+// Options holds database parameters. Nil *Options means defaults.
+type Options struct {
+	// MemtableSize is the approximate size of memtable in bytes after which
+	// it is frozen and flushed into a table file.
+	// If zero, the default of 4MB is used.
+	MemtableSize int
+
+	// TableSize is the approximate size of table files produced by
+	// compaction. If zero, the default of 2MB is used.
+	TableSize int64
+
+	// L0Tables is the number of level 0 tables which triggers their
+	// compaction into level 1. If zero, the default of 4 is used.
+	L0Tables int
+
+	// LevelSize is the max total size of level 1 tables. Each next level is
+	// ten times larger. If zero, the default of 10MB is used.
+	LevelSize int64
+
+	// SyncWrites makes each write to be synced to disk before return.
+	// Otherwise written data may be lost if the machine (but not the process)
+	// crashes.
+	SyncWrites bool
+}
+
+func (opts *Options) withDefaults() Options {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.MemtableSize <= 0 {
+		o.MemtableSize = 4 << 20
+	}
+	if o.TableSize <= 0 {
+		o.TableSize = 2 << 20
+	}
+	if o.L0Tables <= 0 {
+		o.L0Tables = 4
+	}
+	if o.LevelSize <= 0 {
+		o.LevelSize = 10 << 20
+	}
+	return o
+}
+
+// memtable is an in-memory tree along with numbers of log files holding its
+// contents.
+type memtable struct {
+	tree avl.Tree
+	size int
+	logs []uint64
+}
+
+// version is a snapshot of database state used by readers.
+// Note that slices of version are never modified in place.
+type version struct {
+	mem    *memtable
+	imm    []*memtable // Newest first.
+	levels [][]*table  // Level 0 is newest first, others are sorted by keys.
+}
+
+// DB is a key-value database stored in a directory.
+// It is safe for concurrent use.
+type DB struct {
+	dir  string
+	opts Options
+
+	mu     sync.Mutex
+	v      version
+	log    *wal
+	next   uint64
+	err    error
+	closed bool
+
+	// bg serializes flushes and compactions.
+	bg    sync.Mutex
+	flush chan struct{}
+	done  chan struct{}
+}
+
+// Open opens a database stored in dir, creating it if necessary.
+// Contents of the write-ahead logs not yet flushed into table files are
+// recovered into the memtable.
+func Open(dir string, opts *Options) (*DB, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	m, _, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{
+		dir:   dir,
+		opts:  opts.withDefaults(),
+		next:  m.next,
+		flush: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	if db.next == 0 {
+		db.next = 1
+	}
+	if err := db.recover(m); err != nil {
+		db.closeTables()
+		return nil, err
+	}
+	go db.background()
+
+	return db, nil
+}
+
+func (db *DB) recover(m manifest) error {
+	live := make(map[uint64]bool)
+	db.v.levels = make([][]*table, len(m.levels))
+	for level, nums := range m.levels {
+		for _, num := range nums {
+			t, err := openTable(db.dir, num)
+			if err != nil {
+				return err
+			}
+			live[num] = true
+			db.v.levels[level] = append(db.v.levels[level], t)
+		}
+	}
+	mem := new(memtable)
+	names, err := filepath.Glob(filepath.Join(db.dir, "*.*"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		num, ext, ok := parseFileName(name)
+		if !ok {
+			continue
+		}
+		switch {
+		case ext == ".log" && num >= m.log:
+			err := replayWAL(name, func(e entry) {
+				mem.tree, _ = mem.tree.Update(e)
+				mem.size += e.size()
+			})
+			if err != nil {
+				return err
+			}
+			mem.logs = append(mem.logs, num)
+
+		case ext == ".log" || (ext == ".sst" && !live[num]):
+			// Obsolete log or table left by interrupted flush or
+			// compaction.
+			os.Remove(name)
+		}
+		if num >= db.next {
+			db.next = num + 1
+		}
+	}
+	num := db.newFileNum()
+	if db.log, err = createWAL(logPath(db.dir, num), db.opts.SyncWrites); err != nil {
+		return err
+	}
+	mem.logs = append(mem.logs, num)
+	db.v.mem = mem
+
+	return db.saveManifest()
+}
+
+func parseFileName(path string) (num uint64, ext string, ok bool) {
+	name := filepath.Base(path)
+	ext = filepath.Ext(name)
+	num, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+	return num, ext, err == nil
+}
+
+// Put sets the value for the key.
+func (db *DB) Put(key, value []byte) error {
+	return db.write(entry{
+		key:   append([]byte(nil), key...),
+		value: append([]byte{}, value...),
+	})
+}
+
+// Delete deletes the value for the key.
+func (db *DB) Delete(key []byte) error {
+	return db.write(entry{
+		key:     append([]byte(nil), key...),
+		deleted: true,
+	})
+}
+
+func (db *DB) write(e entry) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if db.err != nil {
+		return db.err
+	}
+	if err := db.log.append(e); err != nil {
+		return err
+	}
+	mem := *db.v.mem
+	mem.tree, _ = mem.tree.Update(e)
+	mem.size += e.size()
+	db.v.mem = &mem
+
+	if mem.size >= db.opts.MemtableSize {
+		return db.rotate()
+	}
+	return nil
+}
+
+// rotate freezes current memtable and starts a new one along with a new log
+// file. It must be called with db.mu held.
+func (db *DB) rotate() error {
+	num := db.newFileNum()
+	log, err := createWAL(logPath(db.dir, num), db.opts.SyncWrites)
+	if err != nil {
+		return err
+	}
+	if err := db.log.close(); err != nil {
+		log.close()
+		return err
+	}
+	db.log = log
+	db.v.imm = append([]*memtable{db.v.mem}, db.v.imm...)
+	db.v.mem = &memtable{
+		logs: []uint64{num},
+	}
+	select {
+	case db.flush <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Get returns the value for the key. It returns false if there is no such
+// key.
+func (db *DB) Get(key []byte) (value []byte, ok bool, err error) {
+	v, err := db.acquire()
+	if err != nil {
+		return nil, false, err
+	}
+	defer db.release(v)
+
+	x := entry{key: key}
+	for _, m := range append([]*memtable{v.mem}, v.imm...) {
+		if e := m.tree.Search(x); e != nil {
+			// Copy the value to not let caller modify the memtable.
+			value, ok, err := found(e)
+			return append([]byte(nil), value...), ok, err
+		}
+	}
+	for level, tables := range v.levels {
+		if level > 0 {
+			i := sort.Search(len(tables), func(i int) bool {
+				return bytes.Compare(tables[i].max.key, key) >= 0
+			})
+			if i == len(tables) || bytes.Compare(tables[i].min.key, key) > 0 {
+				continue
+			}
+			tables = tables[i : i+1]
+		}
+		for _, t := range tables {
+			e, err := t.r.Search(x)
+			if err != nil {
+				return nil, false, err
+			}
+			if e != nil {
+				return found(e)
+			}
+		}
+	}
+	return nil, false, nil
+}
+
+func found(x avl.Item) ([]byte, bool, error) {
+	e := x.(entry)
+	if e.deleted {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// Scan calls fn for each key greater than or equal to lo and less than hi in
+// order. Nil lo or hi means no lower or upper bound respectively. If fn
+// returns false it stops iteration.
+//
+// Scan reads a consistent snapshot of the database; writes made while
+// scanning are not visible to it. Note that key and value passed to fn may
+// share memory with the database and must not be modified.
+func (db *DB) Scan(lo, hi []byte, fn func(key, value []byte) bool) error {
+	v, err := db.acquire()
+	if err != nil {
+		return err
+	}
+	defer db.release(v)
+
+	it := newMergeIter(v.iterators(lo)...)
+	for it.Next() {
+		e := it.Item().(entry)
+		if hi != nil && bytes.Compare(e.key, hi) >= 0 {
+			break
+		}
+		if e.deleted {
+			continue
+		}
+		if !fn(e.key, e.value) {
+			break
+		}
+	}
+	return it.Err()
+}
+
+// iterators returns iterators over all the version's data in order of
+// precedence.
+func (v version) iterators(lo []byte) []iterator {
+	var iters []iterator
+	iters = append(iters, newTreeIter(v.mem.tree, lo))
+	for _, m := range v.imm {
+		iters = append(iters, newTreeIter(m.tree, lo))
+	}
+	for level, tables := range v.levels {
+		if level == 0 {
+			for _, t := range tables {
+				iters = append(iters, t.r.Seek(seekItem(lo)))
+			}
+			continue
+		}
+		if lo != nil {
+			i := sort.Search(len(tables), func(i int) bool {
+				return bytes.Compare(tables[i].max.key, lo) >= 0
+			})
+			tables = tables[i:]
+		}
+		iters = append(iters, &levelIter{
+			tables: tables,
+			lo:     lo,
+		})
+	}
+	return iters
+}
+
+// Flush freezes current memtable and waits until all frozen memtables are
+// flushed into table files and compacted.
+func (db *DB) Flush() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	var err error
+	if db.v.mem.size > 0 {
+		err = db.rotate()
+	}
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return db.work()
+}
+
+// Close waits for the background flush to complete and closes the database.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return ErrClosed
+	}
+	db.closed = true
+	close(db.flush)
+	db.mu.Unlock()
+
+	<-db.done
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	err := db.log.close()
+	db.closeTables()
+	if err == nil {
+		err = db.err
+	}
+	return err
+}
+
+func (db *DB) closeTables() {
+	for _, tables := range db.v.levels {
+		for _, t := range tables {
+			t.file.Close()
+		}
+	}
+}
+
+func (db *DB) background() {
+	defer close(db.done)
+	for range db.flush {
+		if err := db.work(); err != nil {
+			db.mu.Lock()
+			db.err = err
+			db.mu.Unlock()
+			return
+		}
+	}
+}
+
+// work flushes all frozen memtables and runs compactions until there is
+// nothing to do.
+func (db *DB) work() error {
+	db.bg.Lock()
+	defer db.bg.Unlock()
+
+	for {
+		ok, err := db.flushOne()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+	}
+	for {
+		ok, err := db.compactOne()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+}
+
+// flushOne writes the oldest frozen memtable into a level 0 table.
+func (db *DB) flushOne() (bool, error) {
+	db.mu.Lock()
+	n := len(db.v.imm)
+	if n == 0 {
+		db.mu.Unlock()
+		return false, nil
+	}
+	m := db.v.imm[n-1]
+	db.mu.Unlock()
+
+	var (
+		tw  = db.tableWriter(0)
+		err error
+	)
+	m.tree.InOrder(func(x avl.Item) bool {
+		err = tw.add(x)
+		return err == nil
+	})
+	if err == nil {
+		err = tw.finish()
+	}
+	if err != nil {
+		tw.abort()
+		return false, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	levels := db.copyLevels()
+	levels[0] = append(tw.tables, levels[0]...)
+	db.v.levels = levels
+	// Note that new memtables could be frozen while we were flushing.
+	db.v.imm = append([]*memtable(nil), db.v.imm[:len(db.v.imm)-1]...)
+	if err := db.saveManifest(); err != nil {
+		return false, err
+	}
+	for _, num := range m.logs {
+		os.Remove(logPath(db.dir, num))
+	}
+	return true, nil
+}
+
+func (db *DB) tableWriter(limit int64) *tableWriter {
+	return &tableWriter{
+		dir:   db.dir,
+		limit: limit,
+		newNum: func() uint64 {
+			db.mu.Lock()
+			defer db.mu.Unlock()
+			return db.newFileNum()
+		},
+	}
+}
+
+// newFileNum returns a new file number. It must be called with db.mu held.
+func (db *DB) newFileNum() uint64 {
+	num := db.next
+	db.next++
+	return num
+}
+
+// copyLevels returns a copy of current levels with one extra level appended.
+// It must be called with db.mu held.
+func (db *DB) copyLevels() [][]*table {
+	levels := make([][]*table, len(db.v.levels), len(db.v.levels)+1)
+	copy(levels, db.v.levels)
+	if len(levels) == 0 {
+		levels = append(levels, nil)
+	}
+	return levels
+}
+
+// saveManifest writes current state to the manifest file. It must be called
+// with db.mu held.
+func (db *DB) saveManifest() error {
+	m := manifest{
+		next: db.next,
+		log:  db.v.mem.logs[0],
+	}
+	if n := len(db.v.imm); n > 0 {
+		m.log = db.v.imm[n-1].logs[0]
+	}
+	for _, tables := range db.v.levels {
+		nums := make([]uint64, len(tables))
+		for i, t := range tables {
+			nums[i] = t.num
+		}
+		m.levels = append(m.levels, nums)
+	}
+	return writeManifest(db.dir, m)
+}
+
+// acquire returns current version of the database, making its tables
+// referenced until release() is called.
+func (db *DB) acquire() (version, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return version{}, ErrClosed
+	}
+	for _, tables := range db.v.levels {
+		for _, t := range tables {
+			t.refs++
+		}
+	}
+	return db.v, nil
+}
+
+func (db *DB) release(v version) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, tables := range v.levels {
+		for _, t := range tables {
+			t.refs--
+			db.maybeRemove(t)
+		}
+	}
+}
+
+// maybeRemove removes obsolete table which is not used by readers anymore.
+// It must be called with db.mu held.
+func (db *DB) maybeRemove(t *table) {
+	if t.obsolete && t.refs == 0 {
+		t.file.Close()
+		os.Remove(t.path)
+	}
+}
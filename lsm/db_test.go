@@ -0,0 +1,226 @@
+package lsm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestDB(t *testing.T) {
+	dir := t.TempDir()
+	opts := &Options{
+		MemtableSize: 512,
+		TableSize:    1024,
+		L0Tables:     2,
+		LevelSize:    4096,
+	}
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := make(map[string]string)
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprintf("key%04d", rnd.Intn(1000))
+		if rnd.Intn(4) == 0 {
+			delete(model, key)
+			if err := db.Delete([]byte(key)); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		value := fmt.Sprintf("value%d", i)
+		model[key] = value
+		if err := db.Put([]byte(key), []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	assertDB(t, db, model)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	assertDB(t, db, model)
+
+	if n := len(db.v.levels); n < 2 {
+		t.Errorf("unexpected number of levels: %d; want compaction to happen", n)
+	}
+}
+
+func TestDBGetCopy(t *testing.T) {
+	db, err := Open(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	v, _, err := db.Get([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Modifying the returned value must not affect the memtable.
+	v[0] = 'X'
+	if v, _, _ = db.Get([]byte("key")); string(v) != "value" {
+		t.Fatalf("unexpected value: %q; want %q", v, "value")
+	}
+}
+
+func TestDBRecover(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := map[string]string{
+		"a": "1",
+		"b": "2",
+	}
+	for k, v := range model {
+		if err := db.Put([]byte(k), []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put([]byte("c"), []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete([]byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a crash: leave the database unclosed and append a torn record
+	// to the log.
+	db.log.close()
+	logs, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(logs) != 1 {
+		t.Fatalf("unexpected log files: %v", logs)
+	}
+	file, err := os.OpenFile(logs[0], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{1, 2, 3, 4, 100, 1})
+	file.Close()
+
+	db, err = Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	assertDB(t, db, model)
+}
+
+func TestDBCorruptedLog(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		off  int  // Offset of corrupted byte in the log.
+		set  byte // Value of corrupted byte; if zero, the byte is inverted.
+	}{
+		{"checksum", 0, 0},
+		{"size", 4, 0x7f},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := Open(dir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 10; i++ {
+				key := fmt.Sprintf("key%04d", i)
+				if err := db.Put([]byte(key), []byte("value")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			db.log.close()
+			logs, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+			if len(logs) != 1 {
+				t.Fatalf("unexpected log files: %v", logs)
+			}
+			data, err := ioutil.ReadFile(logs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.set != 0 {
+				data[test.off] = test.set
+			} else {
+				data[test.off] ^= 0xff
+			}
+			if err := ioutil.WriteFile(logs[0], data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if db, err = Open(dir, nil); err == nil {
+				db.Close()
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func assertDB(t *testing.T, db *DB, model map[string]string) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%04d", i)
+		value, ok, err := db.Get([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp, has := model[key]
+		if ok != has || string(value) != exp {
+			t.Fatalf(
+				"unexpected Get(%q): %q, %t; want %q, %t",
+				key, value, ok, exp, has,
+			)
+		}
+	}
+	var keys []string
+	for k := range model {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var act []string
+	err := db.Scan(nil, nil, func(key, value []byte) bool {
+		if exp := model[string(key)]; string(value) != exp {
+			t.Errorf("unexpected value of %q: %q; want %q", key, value, exp)
+		}
+		act = append(act, string(key))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(act) != fmt.Sprint(keys) {
+		t.Fatalf("unexpected scanned keys:\n%v\nwant:\n%v", act, keys)
+	}
+
+	lo, hi := "key0100", "key0200"
+	act = act[:0]
+	err = db.Scan([]byte(lo), []byte(hi), func(key, _ []byte) bool {
+		act = append(act, string(key))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exp []string
+	for _, k := range keys {
+		if lo <= k && k < hi {
+			exp = append(exp, k)
+		}
+	}
+	if fmt.Sprint(act) != fmt.Sprint(exp) {
+		t.Fatalf("unexpected scanned range:\n%v\nwant:\n%v", act, exp)
+	}
+}
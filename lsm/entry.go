@@ -0,0 +1,76 @@
+package lsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/gobwas/avl"
+)
+
+const flagDeleted = 1
+
+// entry is an item stored in memtables and table files. Deleted entries are
+// tombstones which shadow the older values of the same key.
+type entry struct {
+	key     []byte
+	value   []byte
+	deleted bool
+}
+
+// Compare implements avl.Item interface.
+func (e entry) Compare(x avl.Item) int {
+	return bytes.Compare(e.key, x.(entry).key)
+}
+
+func (e entry) size() int {
+	return len(e.key) + len(e.value) + 1
+}
+
+var errMalformedEntry = errors.New("lsm: malformed entry")
+
+// entryCodec implements avl.ItemCodec for entries.
+type entryCodec struct{}
+
+func (entryCodec) EncodeItem(x avl.Item) ([]byte, error) {
+	return appendEntry(nil, x.(entry)), nil
+}
+
+func (entryCodec) DecodeItem(p []byte) (avl.Item, error) {
+	if len(p) == 0 {
+		return nil, errMalformedEntry
+	}
+	flags := p[0]
+	n, m := binary.Uvarint(p[1:])
+	if m <= 0 || n > uint64(len(p)-1-m) {
+		return nil, errMalformedEntry
+	}
+	p = p[1+m:]
+	// Note that we copy the bytes since the codec must not retain p.
+	e := entry{
+		key:     append([]byte(nil), p[:n]...),
+		deleted: flags&flagDeleted != 0,
+	}
+	if !e.deleted {
+		e.value = append([]byte{}, p[n:]...)
+	}
+	return e, nil
+}
+
+func appendEntry(p []byte, e entry) []byte {
+	var flags byte
+	if e.deleted {
+		flags |= flagDeleted
+	}
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(e.key)))
+	p = append(p, flags)
+	p = append(p, buf[:n]...)
+	p = append(p, e.key...)
+	p = append(p, e.value...)
+	return p
+}
+
+func filterKey(x avl.Item) []byte {
+	return x.(entry).key
+}
@@ -0,0 +1,87 @@
+package lsm
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const manifestName = "MANIFEST"
+
+// manifest describes the persistent state of a database: the set of table
+// files per level and the smallest log number which is not yet flushed.
+type manifest struct {
+	next   uint64
+	log    uint64
+	levels [][]uint64
+}
+
+func readManifest(dir string) (m manifest, ok bool, err error) {
+	file, err := os.Open(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return m, false, nil
+	}
+	if err != nil {
+		return m, false, err
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		var (
+			line  = s.Text()
+			level int
+			num   uint64
+		)
+		switch {
+		case sscan(line, "next %d", &m.next):
+		case sscan(line, "log %d", &m.log):
+		case sscan(line, "table %d %d", &level, &num):
+			for len(m.levels) <= level {
+				m.levels = append(m.levels, nil)
+			}
+			m.levels[level] = append(m.levels[level], num)
+		default:
+			return m, false, fmt.Errorf("lsm: malformed manifest line: %q", line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return m, false, err
+	}
+	return m, true, nil
+}
+
+func sscan(line, format string, args ...interface{}) bool {
+	n, err := fmt.Sscanf(line, format, args...)
+	return err == nil && n == len(args)
+}
+
+// writeManifest atomically replaces the manifest file in dir.
+func writeManifest(dir string, m manifest) error {
+	tmp := filepath.Join(dir, manifestName+".tmp")
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	fmt.Fprintf(w, "next %d\n", m.next)
+	fmt.Fprintf(w, "log %d\n", m.log)
+	for level, nums := range m.levels {
+		for _, num := range nums {
+			fmt.Fprintf(w, "table %d %d\n", level, num)
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, manifestName))
+}
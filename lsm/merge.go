@@ -0,0 +1,151 @@
+package lsm
+
+import "github.com/gobwas/avl"
+
+// iterator iterates over entries in key order.
+type iterator interface {
+	Next() bool
+	Item() avl.Item
+	Err() error
+}
+
+// treeIter iterates over entries of a memtable starting from the given key.
+type treeIter struct {
+	tree avl.Tree
+	seek avl.Item
+	cur  avl.Item
+	done bool
+}
+
+func newTreeIter(t avl.Tree, lo []byte) *treeIter {
+	it := &treeIter{tree: t}
+	if lo != nil {
+		it.seek = entry{key: lo}
+	}
+	return it
+}
+
+func (it *treeIter) Next() bool {
+	if it.done {
+		return false
+	}
+	switch {
+	case it.cur != nil:
+		it.cur = it.tree.Successor(it.cur)
+	case it.seek != nil:
+		if it.cur = it.tree.Search(it.seek); it.cur == nil {
+			it.cur = it.tree.Successor(it.seek)
+		}
+	default:
+		it.cur = it.tree.Min()
+	}
+	it.done = it.cur == nil
+	return !it.done
+}
+
+func (it *treeIter) Item() avl.Item { return it.cur }
+func (it *treeIter) Err() error     { return nil }
+
+// levelIter iterates over non-overlapping tables of a level in order.
+type levelIter struct {
+	tables []*table
+	lo     []byte
+	cur    iterator
+	err    error
+}
+
+func (it *levelIter) Next() bool {
+	for {
+		if it.cur != nil && it.cur.Next() {
+			return true
+		}
+		if it.cur != nil {
+			if it.err = it.cur.Err(); it.err != nil {
+				return false
+			}
+		}
+		if len(it.tables) == 0 {
+			return false
+		}
+		t := it.tables[0]
+		it.tables = it.tables[1:]
+		it.cur = t.r.Seek(seekItem(it.lo))
+	}
+}
+
+func (it *levelIter) Item() avl.Item { return it.cur.Item() }
+func (it *levelIter) Err() error     { return it.err }
+
+func seekItem(key []byte) avl.Item {
+	if key == nil {
+		return nil
+	}
+	return entry{key: key}
+}
+
+// mergeIter merges entries of multiple iterators. Iterators are given in order
+// of precedence: if multiple iterators have entries with the same key, only
+// the entry of the iterator with the least index is used.
+type mergeIter struct {
+	iters []iterator
+	heads []avl.Item
+	cur   avl.Item
+	err   error
+	init  bool
+}
+
+func newMergeIter(iters ...iterator) *mergeIter {
+	return &mergeIter{
+		iters: iters,
+		heads: make([]avl.Item, len(iters)),
+	}
+}
+
+func (it *mergeIter) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.init {
+		it.init = true
+		for i := range it.iters {
+			if !it.advance(i) {
+				return false
+			}
+		}
+	}
+	min := -1
+	for i, x := range it.heads {
+		if x == nil {
+			continue
+		}
+		if min == -1 || x.Compare(it.heads[min]) < 0 {
+			min = i
+		}
+	}
+	if min == -1 {
+		it.cur = nil
+		return false
+	}
+	it.cur = it.heads[min]
+	for i, x := range it.heads {
+		if x != nil && x.Compare(it.cur) == 0 {
+			if !it.advance(i) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (it *mergeIter) advance(i int) bool {
+	if it.iters[i].Next() {
+		it.heads[i] = it.iters[i].Item()
+		return true
+	}
+	it.heads[i] = nil
+	it.err = it.iters[i].Err()
+	return it.err == nil
+}
+
+func (it *mergeIter) Item() avl.Item { return it.cur }
+func (it *mergeIter) Err() error     { return it.err }
@@ -0,0 +1,150 @@
+package lsm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gobwas/avl"
+	"github.com/gobwas/avl/sstable"
+)
+
+var tableOptions = &sstable.Options{
+	FilterKey: filterKey,
+}
+
+// table is an opened table file.
+type table struct {
+	num  uint64
+	path string
+	file *os.File
+	r    *sstable.Reader
+	size int64
+	min  entry
+	max  entry
+
+	// refs is the number of readers using the table. It is protected by
+	// DB's mutex.
+	refs     int
+	obsolete bool
+}
+
+func tablePath(dir string, num uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.sst", num))
+}
+
+func logPath(dir string, num uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.log", num))
+}
+
+func openTable(dir string, num uint64) (*table, error) {
+	path := tablePath(dir, num)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTable(file, num)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("lsm: open table %s: %w", path, err)
+	}
+	return t, nil
+}
+
+func newTable(file *os.File, num uint64) (*table, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r, err := sstable.Open(file, info.Size(), entryCodec{}, tableOptions)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() == 0 {
+		return nil, sstable.ErrCorrupted
+	}
+	max, err := r.Max()
+	if err != nil {
+		return nil, err
+	}
+	return &table{
+		num:  num,
+		path: file.Name(),
+		file: file,
+		r:    r,
+		size: info.Size(),
+		min:  r.Min().(entry),
+		max:  max.(entry),
+	}, nil
+}
+
+// tableWriter writes items into one or more table files, starting a new file
+// when the current one exceeds the limit.
+type tableWriter struct {
+	dir    string
+	limit  int64
+	newNum func() uint64
+
+	file   *os.File
+	w      *sstable.Writer
+	num    uint64
+	size   int64
+	tables []*table
+}
+
+func (tw *tableWriter) add(x avl.Item) error {
+	if tw.w == nil {
+		tw.num = tw.newNum()
+		file, err := os.Create(tablePath(tw.dir, tw.num))
+		if err != nil {
+			return err
+		}
+		tw.file = file
+		tw.w = sstable.NewWriter(file, entryCodec{}, tableOptions)
+		tw.size = 0
+	}
+	if err := tw.w.Add(x); err != nil {
+		return err
+	}
+	tw.size += int64(x.(entry).size())
+	if tw.limit > 0 && tw.size >= tw.limit {
+		return tw.finish()
+	}
+	return nil
+}
+
+func (tw *tableWriter) finish() error {
+	if tw.w == nil {
+		return nil
+	}
+	w, file := tw.w, tw.file
+	tw.w, tw.file = nil, nil
+
+	err := w.Close()
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	t, err := newTable(file, tw.num)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	tw.tables = append(tw.tables, t)
+	return nil
+}
+
+// abort removes all files written so far.
+func (tw *tableWriter) abort() {
+	if tw.file != nil {
+		tw.file.Close()
+		os.Remove(tablePath(tw.dir, tw.num))
+	}
+	for _, t := range tw.tables {
+		t.file.Close()
+		os.Remove(t.path)
+	}
+}
@@ -0,0 +1,163 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// maxWALRecord limits the size of a log record to protect from huge
+// allocations when reading corrupted logs.
+const maxWALRecord = 1 << 30
+
+var errCorruptedWAL = errors.New("lsm: corrupted log record")
+
+// wal is a write-ahead log file. Each record is a CRC-32 checksum followed by
+// uvarint-encoded length and an encoded entry.
+type wal struct {
+	file *os.File
+	w    *bufio.Writer
+	sync bool
+}
+
+func createWAL(path string, sync bool) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &wal{
+		file: file,
+		w:    bufio.NewWriter(file),
+		sync: sync,
+	}, nil
+}
+
+func (l *wal) append(e entry) error {
+	var head [4 + binary.MaxVarintLen64]byte
+	p := appendEntry(nil, e)
+	binary.LittleEndian.PutUint32(head[:], crc32.ChecksumIEEE(p))
+	n := binary.PutUvarint(head[4:], uint64(len(p)))
+	if _, err := l.w.Write(head[:4+n]); err != nil {
+		return err
+	}
+	if _, err := l.w.Write(p); err != nil {
+		return err
+	}
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+	if l.sync {
+		return l.file.Sync()
+	}
+	return nil
+}
+
+func (l *wal) close() error {
+	err := l.w.Flush()
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// replayWAL calls fn for each entry of the log at given path. A torn record
+// at the end of the log, which can only be the result of a crash in the
+// middle of append, stops the replay. A damaged record followed by valid ones
+// is reported as an error.
+func replayWAL(path string, fn func(entry)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	var (
+		r   = bufio.NewReader(file)
+		off int64
+	)
+	for {
+		e, n, err := readWALRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF || err == errCorruptedWAL {
+			// Torn record is always the last one in the log.
+			if !walRecordFollows(file, off, info.Size()) {
+				return nil
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("lsm: replay %s at offset %d: %w", path, off, err)
+		}
+		fn(e)
+		off += n
+	}
+}
+
+// readWALRecord reads a single record of the log. It returns io.EOF if there
+// are no more records and io.ErrUnexpectedEOF if the record is incomplete.
+func readWALRecord(r *bufio.Reader) (e entry, n int64, err error) {
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return e, 0, err
+	}
+	size, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return e, 0, io.ErrUnexpectedEOF
+	}
+	if err != nil || size > maxWALRecord {
+		return e, 0, errCorruptedWAL
+	}
+	p := make([]byte, size)
+	if _, err := io.ReadFull(r, p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return e, 0, err
+	}
+	if crc32.ChecksumIEEE(p) != binary.LittleEndian.Uint32(sum[:]) {
+		return e, 0, errCorruptedWAL
+	}
+	x, err := entryCodec{}.DecodeItem(p)
+	if err != nil {
+		return e, 0, err
+	}
+	var buf [binary.MaxVarintLen64]byte
+	n = int64(len(sum) + binary.PutUvarint(buf[:], size) + len(p))
+
+	return x.(entry), n, nil
+}
+
+// walRecordFollows reports whether a valid record starts anywhere in the log
+// after offset off.
+func walRecordFollows(r io.ReaderAt, off, size int64) bool {
+	var head [4 + binary.MaxVarintLen64]byte
+	for pos := off + 1; pos < size; pos++ {
+		// Look at the header first to not read records which can't fit
+		// the rest of the log.
+		n, _ := r.ReadAt(head[:], pos)
+		if n < 5 {
+			continue
+		}
+		x, m := binary.Uvarint(head[4:n])
+		if m <= 0 || x > maxWALRecord || pos+int64(4+m)+int64(x) > size {
+			continue
+		}
+		br := bufio.NewReader(io.NewSectionReader(r, pos, size-pos))
+		if _, _, err := readWALRecord(br); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+package avl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// mappedMagic is written at the very beginning of a mapped tree file.
+const mappedMagic = "avlmap01"
+
+// mappedHeaderSize is the size of magic followed by 64-bit items count.
+const mappedHeaderSize = len(mappedMagic) + 8
+
+// WriteMapped writes items of t into w using the layout which can be opened
+// later with OpenMapped().
+//
+// The layout is a header followed by a table of 64-bit offsets of each item
+// and then by encoded items themselves, stored in order.
+func WriteMapped(w io.Writer, t Tree, codec ItemCodec) error {
+	bw := bufio.NewWriter(w)
+
+	var head [mappedHeaderSize]byte
+	copy(head[:], mappedMagic)
+	binary.LittleEndian.PutUint64(head[len(mappedMagic):], uint64(t.size))
+	if _, err := bw.Write(head[:]); err != nil {
+		return err
+	}
+	// First pass writes the offsets table; the second one writes items.
+	// Note that items are encoded twice to not hold all of them in memory.
+	var (
+		buf [8]byte
+		off uint64
+		err error
+	)
+	t.root.InOrder(func(x Item) bool {
+		binary.LittleEndian.PutUint64(buf[:], off)
+		if _, err = bw.Write(buf[:]); err != nil {
+			return false
+		}
+		var p []byte
+		if p, err = codec.EncodeItem(x); err != nil {
+			return false
+		}
+		off += uint64(len(p))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint64(buf[:], off)
+	if _, err := bw.Write(buf[:]); err != nil {
+		return err
+	}
+	t.root.InOrder(func(x Item) bool {
+		var p []byte
+		if p, err = codec.EncodeItem(x); err != nil {
+			return false
+		}
+		_, err = bw.Write(p)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Mapped is a read-only view of a tree written by WriteMapped() and mapped
+// into memory.
+//
+// Items are decoded lazily with ItemCodec on each access. That is, opening
+// even a very large file costs almost nothing and produces no garbage.
+// Lookups run in O(log n) decodings.
+//
+// Note that Mapped methods panic if the underlying file is corrupted or if
+// items cannot be decoded, since such errors mean that the file was not
+// produced by WriteMapped() with the same codec.
+type Mapped struct {
+	data  []byte
+	index []byte
+	items []byte
+	size  int
+	codec ItemCodec
+	unmap func([]byte) error
+}
+
+// OpenMapped maps the file at given path into memory and returns read-only
+// view of the tree stored there. Items are decoded with given codec.
+//
+// Note that Close() must be called to release the mapping.
+func OpenMapped(path string, codec ItemCodec) (*Mapped, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size < int64(mappedHeaderSize+8) {
+		return nil, fmt.Errorf("avl: %s is not a mapped tree file", path)
+	}
+	data, unmap, err := mmap(file, int(size))
+	if err != nil {
+		return nil, err
+	}
+	m, err := newMapped(data, codec)
+	if err != nil {
+		unmap(data)
+		return nil, fmt.Errorf("avl: %s: %w", path, err)
+	}
+	m.unmap = unmap
+	return m, nil
+}
+
+func newMapped(data []byte, codec ItemCodec) (*Mapped, error) {
+	if string(data[:len(mappedMagic)]) != mappedMagic {
+		return nil, fmt.Errorf("not a mapped tree file")
+	}
+	n := binary.LittleEndian.Uint64(data[len(mappedMagic):])
+	rest := uint64(len(data) - mappedHeaderSize)
+	if n >= rest/8 {
+		return nil, fmt.Errorf("malformed header")
+	}
+	end := mappedHeaderSize + int(n+1)*8
+	m := &Mapped{
+		data:  data,
+		index: data[mappedHeaderSize:end],
+		items: data[end:],
+		size:  int(n),
+		codec: codec,
+	}
+	if m.offset(m.size) != uint64(len(m.items)) {
+		return nil, fmt.Errorf("malformed offsets table")
+	}
+	return m, nil
+}
+
+// Close releases the memory mapping. Mapped must not be used after Close().
+func (m *Mapped) Close() error {
+	data, unmap := m.data, m.unmap
+	*m = Mapped{}
+	if unmap == nil {
+		return nil
+	}
+	return unmap(data)
+}
+
+// Size returns the number of items.
+// The time complexity is O(1).
+func (m *Mapped) Size() int {
+	return m.size
+}
+
+// At returns an item having given rank, that is, the item having exactly i
+// items less than it. It panics if i is out of range.
+func (m *Mapped) At(i int) Item {
+	if i < 0 || i >= m.size {
+		panic("avl: Mapped item index out of range")
+	}
+	return m.item(i)
+}
+
+// Rank returns the number of items less than x.
+func (m *Mapped) Rank(x Item) int {
+	return m.lowerBound(x)
+}
+
+// Search searches for an item equal to x and returns it.
+func (m *Mapped) Search(x Item) Item {
+	i := m.lowerBound(x)
+	if i == m.size {
+		return nil
+	}
+	if y := m.item(i); x.Compare(y) == 0 {
+		return y
+	}
+	return nil
+}
+
+// Min returns min item.
+func (m *Mapped) Min() Item {
+	if m.size == 0 {
+		return nil
+	}
+	return m.item(0)
+}
+
+// Max returns max item.
+func (m *Mapped) Max() Item {
+	if m.size == 0 {
+		return nil
+	}
+	return m.item(m.size - 1)
+}
+
+// Predecessor returns the greatest item less than x or nil.
+func (m *Mapped) Predecessor(x Item) Item {
+	i := m.lowerBound(x)
+	if i == 0 {
+		return nil
+	}
+	return m.item(i - 1)
+}
+
+// Successor returns the least item greater than x or nil.
+func (m *Mapped) Successor(x Item) Item {
+	i := m.upperBound(x)
+	if i == m.size {
+		return nil
+	}
+	return m.item(i)
+}
+
+// Range calls fn with each item greater than or equal to lo and less than hi
+// in order. Nil lo or hi means no lower or upper bound respectively. If fn
+// returns false it stops iteration.
+func (m *Mapped) Range(lo, hi Item, fn func(Item) bool) {
+	i, j := 0, m.size
+	if lo != nil {
+		i = m.lowerBound(lo)
+	}
+	if hi != nil {
+		j = m.lowerBound(hi)
+	}
+	for ; i < j; i++ {
+		if !fn(m.item(i)) {
+			return
+		}
+	}
+}
+
+// lowerBound returns the index of the first item greater than or equal to x.
+func (m *Mapped) lowerBound(x Item) int {
+	return sort.Search(m.size, func(i int) bool {
+		return x.Compare(m.item(i)) <= 0
+	})
+}
+
+// upperBound returns the index of the first item greater than x.
+func (m *Mapped) upperBound(x Item) int {
+	return sort.Search(m.size, func(i int) bool {
+		return x.Compare(m.item(i)) < 0
+	})
+}
+
+func (m *Mapped) offset(i int) uint64 {
+	return binary.LittleEndian.Uint64(m.index[i*8:])
+}
+
+func (m *Mapped) item(i int) Item {
+	lo, hi := m.offset(i), m.offset(i+1)
+	if lo > hi || hi > uint64(len(m.items)) {
+		panic("avl: corrupted mapped tree offsets table")
+	}
+	x, err := m.codec.DecodeItem(m.items[lo:hi])
+	if err != nil {
+		panic(fmt.Sprintf("avl: decode mapped item: %v", err))
+	}
+	return x
+}
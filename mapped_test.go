@@ -0,0 +1,83 @@
+package avl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMapped(t *testing.T) {
+	// Tree holds even numbers from 0 to 98.
+	var tree Tree
+	for i := 0; i < 50; i++ {
+		tree, _ = tree.Insert(IntItem(i * 2))
+	}
+	m := openMapped(t, tree)
+	defer m.Close()
+
+	if act, exp := m.Size(), 50; act != exp {
+		t.Fatalf("unexpected size: %d; want %d", act, exp)
+	}
+	if act, exp := m.Min(), IntItem(0); act != exp {
+		t.Errorf("unexpected min: %v; want %v", act, exp)
+	}
+	if act, exp := m.Max(), IntItem(98); act != exp {
+		t.Errorf("unexpected max: %v; want %v", act, exp)
+	}
+	for x := -1; x <= 100; x++ {
+		if act, exp := m.Search(IntItem(x)), tree.Search(IntItem(x)); act != exp {
+			t.Errorf("unexpected Search(%d): %v; want %v", x, act, exp)
+		}
+		if act, exp := m.Predecessor(IntItem(x)), tree.Predecessor(IntItem(x)); act != exp {
+			t.Errorf("unexpected Predecessor(%d): %v; want %v", x, act, exp)
+		}
+		if act, exp := m.Successor(IntItem(x)), tree.Successor(IntItem(x)); act != exp {
+			t.Errorf("unexpected Successor(%d): %v; want %v", x, act, exp)
+		}
+	}
+	if act, exp := m.Rank(IntItem(11)), 6; act != exp {
+		t.Errorf("unexpected Rank(11): %d; want %d", act, exp)
+	}
+	if act, exp := m.At(6), IntItem(12); act != exp {
+		t.Errorf("unexpected At(6): %v; want %v", act, exp)
+	}
+	assertOrder(t, "range", []int{10, 12, 14}, func(fn func(Item) bool) bool {
+		m.Range(IntItem(9), IntItem(16), fn)
+		return true
+	})
+	assertOrder(t, "range", []int{94, 96, 98}, func(fn func(Item) bool) bool {
+		m.Range(IntItem(94), nil, fn)
+		return true
+	})
+}
+
+func TestMappedEmpty(t *testing.T) {
+	m := openMapped(t, Tree{})
+	defer m.Close()
+
+	if m.Size() != 0 || m.Min() != nil || m.Max() != nil {
+		t.Fatalf("unexpected non-empty tree")
+	}
+	if x := m.Search(IntItem(1)); x != nil {
+		t.Fatalf("unexpected Search() result: %v", x)
+	}
+}
+
+func openMapped(t *testing.T, tree Tree) *Mapped {
+	path := filepath.Join(t.TempDir(), "tree")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMapped(file, tree, intCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m, err := OpenMapped(path, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
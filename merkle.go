@@ -0,0 +1,130 @@
+package avl
+
+import (
+	"crypto"
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+)
+
+// Prefixes used to separate digests of empty subtrees from digests of nodes.
+const (
+	digestEmpty byte = 0
+	digestNode  byte = 1
+)
+
+// merkle holds parameters of a Merkle tree.
+type merkle struct {
+	hash  crypto.Hash
+	codec ItemCodec
+	empty []byte
+}
+
+// NewMerkle returns an empty Merkle tree. Merkle tree is a regular Tree,
+// each subtree of which additionally has a digest of its root item and its
+// children's digests. Items are encoded with given codec before hashing.
+//
+// Digests are computed only for nodes copied by modifying operations, that
+// is, maintaining them costs O(log n) hash computations per operation.
+// Digests are kept in nodes of Merkle trees only, such that regular trees do
+// not pay for them.
+//
+// Note that hash function must be linked into the binary, for example by
+// importing crypto/sha256 package. Note also that since Insert(), Update()
+// and Delete() do not return errors, they panic if the codec fails to encode
+// an item.
+func NewMerkle(h crypto.Hash, codec ItemCodec) Tree {
+	if !h.Available() {
+		panic(fmt.Sprintf("avl: hash function %v is not available", h))
+	}
+	m := &merkle{
+		hash:  h,
+		codec: codec,
+	}
+	w := h.New()
+	w.Write([]byte{digestEmpty})
+	m.empty = w.Sum(nil)
+
+	return Tree{merkle: m}
+}
+
+// RootHash returns the digest of the whole tree. It returns nil if t is not a
+// Merkle tree.
+// The time complexity is O(1).
+func (t Tree) RootHash() []byte {
+	if t.merkle == nil {
+		return nil
+	}
+	return append([]byte(nil), t.merkle.digest(t.root)...)
+}
+
+// merkleNode is a node of a Merkle tree. Merkle trees consist of nodes
+// allocated as merkleNode only, such that regular trees do not pay for the
+// digest field.
+type merkleNode struct {
+	node
+	digest []byte // Subtree digest; nil if not computed yet.
+}
+
+// asMerkle returns the merkleNode which embeds n. It must be called only for
+// nodes having the merkle flag set.
+func (n *node) asMerkle() *merkleNode {
+	return (*merkleNode)(unsafe.Pointer(n))
+}
+
+// rehash computes digests of nodes created or copied while modifying a tree
+// rooted at n and returns the new root. Subtrees shared with previous
+// versions of the tree already have digests and are not visited.
+//
+// Nodes allocated as regular ones are replaced by their Merkle copies. Note
+// that all such nodes (as well as copies of Merkle nodes) are not shared with
+// any other tree yet, thus their children can be updated in place.
+func (m *merkle) rehash(n *node) *node {
+	if m == nil || n == nil {
+		return n
+	}
+	if n.merkle && n.asMerkle().digest != nil {
+		return n
+	}
+	if !n.merkle {
+		cp := &merkleNode{node: *n}
+		cp.merkle = true
+		n = &cp.node
+	}
+	n.left = m.rehash(n.left)
+	n.right = m.rehash(n.right)
+	n.asMerkle().digest = m.nodeDigest(m.encode(n.value), m.digest(n.left), m.digest(n.right))
+	return n
+}
+
+func (m *merkle) digest(n *node) []byte {
+	if n == nil {
+		return m.empty
+	}
+	return n.asMerkle().digest
+}
+
+func (m *merkle) encode(x Item) []byte {
+	p, err := m.codec.EncodeItem(x)
+	if err != nil {
+		panic(fmt.Sprintf("avl: encode item: %v", err))
+	}
+	return p
+}
+
+func (m *merkle) nodeDigest(item, left, right []byte) []byte {
+	return nodeDigest(m.hash, item, left, right)
+}
+
+func nodeDigest(h crypto.Hash, item, left, right []byte) []byte {
+	var buf [1 + binary.MaxVarintLen64]byte
+	buf[0] = digestNode
+	n := binary.PutUvarint(buf[1:], uint64(len(item)))
+
+	w := h.New()
+	w.Write(buf[:1+n])
+	w.Write(item)
+	w.Write(left)
+	w.Write(right)
+	return w.Sum(nil)
+}
@@ -0,0 +1,128 @@
+package avl
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256"
+	"math/rand"
+	"testing"
+	"unsafe"
+)
+
+func TestMerkleRootHash(t *testing.T) {
+	codec := &countingCodec{}
+	tree := NewMerkle(crypto.SHA256, codec)
+	empty := tree.RootHash()
+
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 1000; i++ {
+		x := IntItem(rnd.Intn(500))
+		codec.n = 0
+		if rnd.Intn(3) == 0 {
+			tree, _ = tree.Delete(x)
+		} else {
+			tree, _ = tree.Update(x)
+		}
+		// Only the copied path must be rehashed.
+		if max := 3 * tree.root.height(); codec.n > max {
+			t.Fatalf("too many items hashed: %d; want at most %d", codec.n, max)
+		}
+		if act, exp := tree.RootHash(), fullDigest(tree.merkle, tree.root); !bytes.Equal(act, exp) {
+			t.Fatalf("unexpected root hash after %d operations", i)
+		}
+	}
+	prev := tree.RootHash()
+	tree, _ = tree.Insert(IntItem(1000))
+	if bytes.Equal(tree.RootHash(), prev) {
+		t.Fatalf("root hash didn't change after insertion")
+	}
+	tree, _ = tree.Delete(IntItem(1000))
+	if !bytes.Equal(tree.RootHash(), prev) {
+		t.Fatalf("root hash is not restored after deletion")
+	}
+	for tree.Size() > 0 {
+		tree, _ = tree.Delete(tree.Min())
+	}
+	if !bytes.Equal(tree.RootHash(), empty) {
+		t.Fatalf("unexpected root hash of empty tree")
+	}
+}
+
+func TestMerkleCompare(t *testing.T) {
+	// Maintaining digests must not compare items, that is, Merkle tree
+	// operations must do exactly the same comparisons as regular ones.
+	var (
+		n      int
+		merkle = NewMerkle(crypto.SHA256, countingItemCodec{})
+		plain  Tree
+	)
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 1000; i++ {
+		x := countingItem{IntItem(rnd.Intn(500)), &n}
+		var (
+			mn, pn int
+			del    = rnd.Intn(3) == 0
+		)
+		for _, tree := range []*Tree{&merkle, &plain} {
+			n = 0
+			if del {
+				*tree, _ = tree.Delete(x)
+			} else {
+				*tree, _ = tree.Update(x)
+			}
+			mn, pn = pn, n
+		}
+		if mn != pn {
+			t.Fatalf("unexpected number of comparisons: %d; want %d", mn, pn)
+		}
+	}
+}
+
+func TestMerkleRootHashPlainTree(t *testing.T) {
+	var tree Tree
+	tree, _ = tree.Insert(IntItem(1))
+	if h := tree.RootHash(); h != nil {
+		t.Fatalf("unexpected root hash of non-Merkle tree: %x", h)
+	}
+}
+
+func TestMerkleNodeSize(t *testing.T) {
+	// Merkle digests must not increase the size of regular tree nodes.
+	var (
+		item = unsafe.Sizeof(Item(nil))
+		ptr  = unsafe.Sizeof(uintptr(0))
+	)
+	if act, exp := unsafe.Sizeof(node{}), item+3*ptr; act != exp {
+		t.Fatalf("unexpected node size: %d; want %d", act, exp)
+	}
+}
+
+// fullDigest computes digest of n ignoring cached digests.
+func fullDigest(m *merkle, n *node) []byte {
+	if n == nil {
+		return m.empty
+	}
+	return m.nodeDigest(
+		m.encode(n.value),
+		fullDigest(m, n.left),
+		fullDigest(m, n.right),
+	)
+}
+
+type countingCodec struct {
+	intCodec
+	n int
+}
+
+func (c *countingCodec) EncodeItem(x Item) ([]byte, error) {
+	c.n++
+	return c.intCodec.EncodeItem(x)
+}
+
+type countingItemCodec struct {
+	intCodec
+}
+
+func (c countingItemCodec) EncodeItem(x Item) ([]byte, error) {
+	return c.intCodec.EncodeItem(x.(countingItem).IntItem)
+}
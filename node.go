@@ -1,5 +1,7 @@
 package avl
 
+import "fmt"
+
 // Item holds a piece of information needed to be stored (or searched by) in a
 // tree.
 //
@@ -24,7 +26,8 @@ package avl
 //	user := tree.Search(ID(42))
 //
 // That is, Item can represent both the key for searching and value for storing
-// (or searching).
+// (or searching). For ad-hoc lookups there is no need to define a type, see
+// Tree.SearchFunc() and Tree.FindFirst().
 type Item interface {
 	// Compare compares item itself with another item usually stored in a tree.
 	// It reports whether the receiver is less, greater or equal to the given
@@ -33,12 +36,28 @@ type Item interface {
 	Compare(Item) int
 }
 
+// Equaler is an optional interface of Item which reports whether the item is
+// equal to another one in value, not only in terms of Compare(). Modifying
+// operations use it to detect that an item is replaced by an equal one, which
+// leaves the tree unchanged (see Tree.Unchanged()).
+type Equaler interface {
+	Equal(Item) bool
+}
+
+// equalItems reports whether x is equal to y in value.
+// Items not implementing Equaler are never equal.
+func equalItems(x, y Item) bool {
+	e, ok := x.(Equaler)
+	return ok && e.Equal(y)
+}
+
 // node is a node of a tree.
 type node struct {
-	value Item
-	left  *node
-	right *node
-	h     int // Subtree height.
+	value  Item
+	left   *node
+	right  *node
+	h      int16 // Subtree height.
+	merkle bool  // Node is embedded into merkleNode.
 }
 
 // Size returns the size of a subtree rooted by n.
@@ -93,7 +112,8 @@ func (n *node) Insert(x Item) (root *node, existing Item) {
 // Update updates a node having value x in the tree.
 // It replaces the value of a node if it already exists in the tree or inserts
 // new one with value x. It returns new tree root and an old value if it
-// was present in the tree and replaced by x.
+// was present in the tree and replaced by x. If x is equal to the old value
+// (see Equaler) it returns n.
 func (n *node) Update(x Item) (root *node, prev Item) {
 	if n == nil {
 		return &node{
@@ -101,15 +121,32 @@ func (n *node) Update(x Item) (root *node, prev Item) {
 			h:     1,
 		}, nil
 	}
-	root = n.clone()
-	cmp := x.Compare(root.value)
+	cmp := x.Compare(n.value)
 	switch {
 	case cmp < 0:
-		root.left, prev = n.left.Update(x)
+		var m *node
+		m, prev = n.left.Update(x)
+		if m != n.left {
+			root = n.clone()
+			root.left = m
+		}
 	case cmp > 0:
-		root.right, prev = n.right.Update(x)
+		var m *node
+		m, prev = n.right.Update(x)
+		if m != n.right {
+			root = n.clone()
+			root.right = m
+		}
 	default:
-		root.value, prev = x, root.value
+		prev = n.value
+		if !equalItems(x, prev) {
+			root = n.clone()
+			root.value = x
+		}
+	}
+	if root == nil {
+		// x is equal to the existing value.
+		return n, prev
 	}
 
 	root.adjustHeight()
@@ -158,6 +195,79 @@ func (n *node) Delete(x Item) (root *node, existed Item) {
 	return root.rebalance(), existed
 }
 
+// Modify finds a node having value x and calls fn with its value or with nil
+// if there is no such node. Depending on returned action it inserts, replaces
+// or deletes the node. It returns new tree root, the value passed to fn and
+// the action made. If action is ActionKeep, the root is n.
+func (n *node) Modify(x Item, fn func(Item, bool) (Item, Action)) (root *node, old Item, act Action) {
+	if n == nil {
+		y, act := fn(nil, false)
+		switch act {
+		case ActionKeep, ActionDelete:
+			return nil, nil, ActionKeep
+		case ActionPut:
+			mustModify(x, y)
+			return &node{
+				value: y,
+				h:     1,
+			}, nil, ActionPut
+		}
+		panic(fmt.Sprintf("avl: unexpected action: %d", act))
+	}
+	cmp := x.Compare(n.value)
+	switch {
+	case cmp < 0:
+		var m *node
+		m, old, act = n.left.Modify(x, fn)
+		if act == ActionKeep {
+			return n, old, act
+		}
+		root = n.clone()
+		root.left = m
+	case cmp > 0:
+		var m *node
+		m, old, act = n.right.Modify(x, fn)
+		if act == ActionKeep {
+			return n, old, act
+		}
+		root = n.clone()
+		root.right = m
+	default:
+		var y Item
+		old = n.value
+		y, act = fn(old, true)
+		switch act {
+		case ActionKeep:
+			return n, old, act
+		case ActionPut:
+			mustModify(x, y)
+			if equalItems(y, old) {
+				return n, old, ActionKeep
+			}
+			root = n.clone()
+			root.value = y
+		case ActionDelete:
+			root = n.destroy()
+		default:
+			panic(fmt.Sprintf("avl: unexpected action: %d", act))
+		}
+		if root == nil {
+			// x was the last element of n.
+			return nil, old, act
+		}
+	}
+
+	root.adjustHeight()
+
+	return root.rebalance(), old, act
+}
+
+func mustModify(x, y Item) {
+	if y == nil || x.Compare(y) != 0 {
+		panic("avl: modified item is not equal to the searched one")
+	}
+}
+
 // Max returns max value of the tree.
 func (n *node) Max() Item {
 	if n == nil {
@@ -180,6 +290,40 @@ func (n *node) Min() Item {
 	return n.value
 }
 
+// PopMin deletes a node having min value.
+// It returns new tree root node and the deleted value.
+func (n *node) PopMin() (root *node, min Item) {
+	if n == nil {
+		return nil, nil
+	}
+	if n.left == nil {
+		return n.right, n.value
+	}
+	root = n.clone()
+	root.left, min = n.left.PopMin()
+
+	root.adjustHeight()
+
+	return root.rebalance(), min
+}
+
+// PopMax deletes a node having max value.
+// It returns new tree root node and the deleted value.
+func (n *node) PopMax() (root *node, max Item) {
+	if n == nil {
+		return nil, nil
+	}
+	if n.right == nil {
+		return n.left, n.value
+	}
+	root = n.clone()
+	root.right, max = n.right.PopMax()
+
+	root.adjustHeight()
+
+	return root.rebalance(), max
+}
+
 // Search searches for a node having value x and return its value.
 // Note that x and node's value essentially can be a different types sharing
 // comparison logic.
@@ -240,37 +384,116 @@ func (n *node) Successor(x Item) Item {
 	}
 }
 
+// Floor finds a node having the greatest value less than or equal to x.
+// It returns value of found node or nil.
+func (n *node) Floor(x Item) Item {
+	var ret Item
+	for n != nil {
+		cmp := x.Compare(n.value)
+		switch {
+		case cmp < 0:
+			n = n.left
+		case cmp > 0:
+			ret, n = n.value, n.right
+		default:
+			return n.value
+		}
+	}
+	return ret
+}
+
+// Ceiling finds a node having the least value greater than or equal to x.
+// It returns value of found node or nil.
+func (n *node) Ceiling(x Item) Item {
+	var ret Item
+	for n != nil {
+		cmp := x.Compare(n.value)
+		switch {
+		case cmp < 0:
+			ret, n = n.value, n.left
+		case cmp > 0:
+			n = n.right
+		default:
+			return n.value
+		}
+	}
+	return ret
+}
+
+// Nearest finds a node having value closest to x in terms of distance
+// function. Only floor and ceiling of x are considered. If they are at equal
+// distance, the floor is preferred. It returns value of found node or nil.
+func (n *node) Nearest(x Item, distance func(x, y Item) float64) Item {
+	var floor, ceiling Item
+	for n != nil {
+		cmp := x.Compare(n.value)
+		switch {
+		case cmp < 0:
+			ceiling, n = n.value, n.left
+		case cmp > 0:
+			floor, n = n.value, n.right
+		default:
+			return n.value
+		}
+	}
+	switch {
+	case floor == nil:
+		return ceiling
+	case ceiling == nil:
+		return floor
+	case distance(x, ceiling) < distance(x, floor):
+		return ceiling
+	default:
+		return floor
+	}
+}
+
 // InOrder prepares in-order traversal of the tree and calls fn with value of
-// each visited node.
-func (n *node) InOrder(fn func(Item) bool) {
+// each visited node. It returns false if fn returned false and traversal was
+// stopped.
+func (n *node) InOrder(fn func(Item) bool) bool {
 	if n == nil {
-		return
+		return true
 	}
-	n.left.InOrder(fn)
-	fn(n.value)
-	n.right.InOrder(fn)
+	return n.left.InOrder(fn) && fn(n.value) && n.right.InOrder(fn)
 }
 
 // PreOrder prepares pre-order traversal of the tree and calls fn with value of
-// each visited node.
-func (n *node) PreOrder(fn func(Item) bool) {
+// each visited node. It returns false if fn returned false and traversal was
+// stopped.
+func (n *node) PreOrder(fn func(Item) bool) bool {
 	if n == nil {
-		return
+		return true
 	}
-	fn(n.value)
-	n.left.PreOrder(fn)
-	n.right.PreOrder(fn)
+	return fn(n.value) && n.left.PreOrder(fn) && n.right.PreOrder(fn)
 }
 
 // PostOrder prepares post-order traversal of the tree and calls fn with value
-// of each visited node.
-func (n *node) PostOrder(fn func(Item) bool) {
+// of each visited node. It returns false if fn returned false and traversal
+// was stopped.
+func (n *node) PostOrder(fn func(Item) bool) bool {
 	if n == nil {
-		return
+		return true
 	}
-	n.left.PostOrder(fn)
-	n.right.PostOrder(fn)
-	fn(n.value)
+	return n.left.PostOrder(fn) && n.right.PostOrder(fn) && fn(n.value)
+}
+
+// ascend calls fn with values of nodes greater than or equal to lo and less
+// than hi in order. Nil lo or hi means no lower or upper bound respectively.
+// It returns false if fn returned false and traversal was stopped.
+func (n *node) ascend(lo, hi Item, fn func(Item) bool) bool {
+	if n == nil {
+		return true
+	}
+	if lo != nil && lo.Compare(n.value) > 0 {
+		return n.right.ascend(lo, hi, fn)
+	}
+	if hi != nil && hi.Compare(n.value) <= 0 {
+		return n.left.ascend(lo, hi, fn)
+	}
+	return n.left.ascend(lo, nil, fn) &&
+		fn(n.value) &&
+		n.right.ascend(nil, hi, fn)
 }
 
 func (n *node) destroy() *node {
@@ -302,14 +525,14 @@ func (n *node) destroy() *node {
 }
 
 func (n *node) adjustHeight() {
-	n.h = max(n.left.height(), n.right.height()) + 1
+	n.h = int16(max(n.left.height(), n.right.height()) + 1)
 }
 
 func (n *node) height() int {
 	if n == nil {
 		return 0
 	}
-	return n.h
+	return int(n.h)
 }
 
 func (n *node) balance() int {
@@ -405,6 +628,11 @@ func (n *node) clone() *node {
 	if n == nil {
 		return nil
 	}
+	if n.merkle {
+		// Keep the copy a Merkle node, but with the digest to be computed.
+		cp := &merkleNode{node: *n}
+		return &cp.node
+	}
 	cp := *n
 	return &cp
 }
@@ -415,3 +643,19 @@ func max(a, b int) int {
 	}
 	return b
 }
+
+// build builds a perfectly balanced tree from sorted items. The middle item
+// (or the right one of two middle items) becomes the root.
+func build(items []Item) *node {
+	if len(items) == 0 {
+		return nil
+	}
+	mid := len(items) / 2
+	n := &node{
+		value: items[mid],
+		left:  build(items[:mid]),
+		right: build(items[mid+1:]),
+	}
+	n.adjustHeight()
+	return n
+}
@@ -22,6 +22,54 @@ func TestUpdate(t *testing.T) {
 	}
 }
 
+func TestUpdateEqual(t *testing.T) {
+	var tree Tree
+	for i := 0; i < 10; i++ {
+		tree, _ = tree.Insert(pair{i, i})
+	}
+	same, prev := tree.Update(pair{5, 5})
+	if prev != (pair{5, 5}) {
+		t.Fatalf("unexpected prev item: %v", prev)
+	}
+	if !same.Unchanged(tree) {
+		t.Fatalf("tree is changed after update with equal item")
+	}
+	same, _ = tree.Modify(pair{5, 0}, func(old Item, _ bool) (Item, Action) {
+		return old, ActionPut
+	})
+	if !same.Unchanged(tree) {
+		t.Fatalf("tree is changed after modify with equal item")
+	}
+	changed, _ := tree.Update(pair{5, 6})
+	if changed.Unchanged(tree) {
+		t.Fatalf("tree is not changed after update with different item")
+	}
+	if x := changed.Search(pair{5, 0}); x != (pair{5, 6}) {
+		t.Fatalf("unexpected updated item: %v", x)
+	}
+	var n int
+	Diff(tree, changed, func(x, y Item) bool {
+		n++
+		return true
+	})
+	if n != 1 {
+		t.Fatalf("unexpected number of differences: %d; want 1", n)
+	}
+}
+
+// pair is an item ordered by key and compared by value with Equal().
+type pair struct {
+	key, value int
+}
+
+func (p pair) Compare(x Item) int {
+	return p.key - x.(pair).key
+}
+
+func (p pair) Equal(x Item) bool {
+	return p.value == x.(pair).value
+}
+
 func TestSearch(t *testing.T) {
 	for _, test := range []struct {
 		name   string
@@ -227,6 +275,182 @@ func TestPredecessorSuccessor(t *testing.T) {
 	}
 }
 
+func TestModify(t *testing.T) {
+	tree := buildTreeFrom(makeRange(0, 10)...)
+	for _, test := range []struct {
+		name   string
+		x      int
+		fn     func(Item, bool) (Item, Action)
+		exp    []int
+		old    Item
+		same   bool
+		panics bool
+	}{
+		{
+			name: "keep",
+			x:    5,
+			fn:   func(Item, bool) (Item, Action) { return nil, ActionKeep },
+			exp:  makeRange(0, 10),
+			old:  IntItem(5),
+			same: true,
+		},
+		{
+			name: "delete absent",
+			x:    15,
+			fn:   func(Item, bool) (Item, Action) { return nil, ActionDelete },
+			exp:  makeRange(0, 10),
+			same: true,
+		},
+		{
+			name: "insert",
+			x:    15,
+			fn: func(old Item, found bool) (Item, Action) {
+				if found {
+					panic("unexpected found item")
+				}
+				return IntItem(15), ActionPut
+			},
+			exp: append(makeRange(0, 10), 15),
+		},
+		{
+			name: "replace",
+			x:    3,
+			fn:   func(old Item, _ bool) (Item, Action) { return old, ActionPut },
+			exp:  makeRange(0, 10),
+			old:  IntItem(3),
+		},
+		{
+			name: "delete",
+			x:    3,
+			fn:   func(Item, bool) (Item, Action) { return nil, ActionDelete },
+			exp:  append(makeRange(0, 3), makeRange(4, 10)...),
+			old:  IntItem(3),
+		},
+		{
+			name:   "put non-equal",
+			x:      3,
+			fn:     func(Item, bool) (Item, Action) { return IntItem(4), ActionPut },
+			panics: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if err := recover(); (err != nil) != test.panics {
+					t.Fatalf("unexpected panic: %v", err)
+				}
+			}()
+			act, old := tree.Modify(IntItem(test.x), test.fn)
+			if old != test.old {
+				t.Errorf("unexpected old item: %v; want %v", old, test.old)
+			}
+			if same := act.root == tree.root; same != test.same {
+				t.Errorf("unexpected tree identity: %t; want %t", same, test.same)
+			}
+			if act.Size() != len(test.exp) {
+				t.Errorf("unexpected size: %d; want %d", act.Size(), len(test.exp))
+			}
+			assertInOrder(t, act.root, test.exp)
+			assertBalanced(t, act.root)
+		})
+	}
+}
+
+func TestFloorCeiling(t *testing.T) {
+	// Tree holds even numbers from 0 to 18.
+	root := buildTree(t, []int{0, 2, 4, 6, 8, 10, 12, 14, 16, 18}, nil)
+	for x := -2; x <= 20; x++ {
+		var floor, ceiling Item
+		switch {
+		case x < 0:
+			ceiling = IntItem(0)
+		case x > 18:
+			floor = IntItem(18)
+		case x%2 == 0:
+			floor, ceiling = IntItem(x), IntItem(x)
+		default:
+			floor, ceiling = IntItem(x-1), IntItem(x+1)
+		}
+		if act := root.Floor(IntItem(x)); act != floor {
+			t.Errorf("unexpected floor of %d: %v; want %v", x, act, floor)
+		}
+		if act := root.Ceiling(IntItem(x)); act != ceiling {
+			t.Errorf("unexpected ceiling of %d: %v; want %v", x, act, ceiling)
+		}
+	}
+}
+
+func TestNearest(t *testing.T) {
+	distance := func(x, y Item) float64 {
+		return math.Abs(float64(x.(IntItem) - y.(IntItem)))
+	}
+	root := buildTree(t, []int{0, 10, 13, 20}, nil)
+	for _, test := range []struct {
+		x   int
+		exp Item
+	}{
+		{-5, IntItem(0)},
+		{0, IntItem(0)},
+		{4, IntItem(0)},
+		{5, IntItem(0)}, // Floor is preferred.
+		{6, IntItem(10)},
+		{12, IntItem(13)},
+		{17, IntItem(20)},
+		{100, IntItem(20)},
+	} {
+		if act := root.Nearest(IntItem(test.x), distance); act != test.exp {
+			t.Errorf("unexpected nearest to %d: %v; want %v", test.x, act, test.exp)
+		}
+	}
+	var empty *node
+	if act := empty.Nearest(IntItem(1), distance); act != nil {
+		t.Errorf("unexpected nearest in empty tree: %v", act)
+	}
+}
+
+func TestPopMinMax(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		pop  func(*node) (*node, Item)
+		exp  func([]int) (int, []int)
+	}{
+		{
+			name: "min",
+			pop:  (*node).PopMin,
+			exp: func(xs []int) (int, []int) {
+				return xs[0], xs[1:]
+			},
+		},
+		{
+			name: "max",
+			pop:  (*node).PopMax,
+			exp: func(xs []int) (int, []int) {
+				return xs[len(xs)-1], xs[:len(xs)-1]
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			xs := makeRange(0, 100)
+			root := buildTree(t, xs, nil)
+			for len(xs) > 0 {
+				var (
+					x   Item
+					exp int
+				)
+				root, x = test.pop(root)
+				exp, xs = test.exp(xs)
+				if act := int(x.(IntItem)); act != exp {
+					t.Fatalf("unexpected popped item: %d; want %d", act, exp)
+				}
+				assertInOrder(t, root, xs)
+				assertBalanced(t, root)
+			}
+			if root, x := test.pop(root); root != nil || x != nil {
+				t.Fatalf("unexpected result for empty tree: %v", x)
+			}
+		})
+	}
+}
+
 func TestBalance(t *testing.T) {
 	for _, test := range []struct {
 		name      string
@@ -381,6 +605,21 @@ func buildTree(t testing.TB, insert, delete []int) *node {
 	return root
 }
 
+func makeRange(lo, hi int) []int {
+	xs := make([]int, 0, hi-lo)
+	for i := lo; i < hi; i++ {
+		xs = append(xs, i)
+	}
+	return xs
+}
+
+func buildTreeFrom(xs ...int) (t Tree) {
+	for _, x := range xs {
+		t, _ = t.Insert(IntItem(x))
+	}
+	return t
+}
+
 func assertItem(t *testing.T, name string, exp int, getter func() Item) {
 	act := int(getter().(IntItem))
 	if act != exp {
@@ -398,7 +637,7 @@ func assertMax(t *testing.T, root *node, exp int) {
 	assertItem(t, "max", exp, root.Max)
 }
 
-func assertOrder(t *testing.T, name string, exp []int, iterator func(func(Item) bool)) {
+func assertOrder(t *testing.T, name string, exp []int, iterator func(func(Item) bool) bool) {
 	var i int
 	iterator(func(x Item) bool {
 		act := int(x.(IntItem))
@@ -435,3 +674,72 @@ func (a IntItem) Compare(b Item) int {
 func (a IntItem) String() string {
 	return fmt.Sprintf("%d", int(a))
 }
+
+func TestTraversalStop(t *testing.T) {
+	root := buildTree(t, []int{1, 2, 3, 4, 5}, nil)
+	for _, test := range []struct {
+		name     string
+		traverse func(func(Item) bool) bool
+	}{
+		{"in-order", root.InOrder},
+		{"pre-order", root.PreOrder},
+		{"post-order", root.PostOrder},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var n int
+			ok := test.traverse(func(Item) bool {
+				n++
+				return n < 2
+			})
+			if ok {
+				t.Errorf("unexpected traversal result: %v", ok)
+			}
+			if n != 2 {
+				t.Errorf("unexpected number of visited nodes: %d; want 2", n)
+			}
+		})
+	}
+}
+
+func TestTreeTraversalStop(t *testing.T) {
+	tree := buildTreeFrom(1, 2, 3, 4, 5)
+	for _, test := range []struct {
+		name     string
+		traverse func(func(Item) bool)
+	}{
+		{"in-order", tree.InOrder},
+		{"pre-order", tree.PreOrder},
+		{"post-order", tree.PostOrder},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var n int
+			test.traverse(func(Item) bool {
+				n++
+				return false
+			})
+			if n != 1 {
+				t.Errorf("unexpected number of visited nodes: %d; want 1", n)
+			}
+		})
+	}
+}
+
+func TestAscend(t *testing.T) {
+	root := buildTree(t, makeRange(0, 10), nil)
+	for _, test := range []struct {
+		lo, hi Item
+		exp    []int
+	}{
+		{nil, nil, makeRange(0, 10)},
+		{IntItem(3), nil, makeRange(3, 10)},
+		{nil, IntItem(3), makeRange(0, 3)},
+		{IntItem(3), IntItem(7), makeRange(3, 7)},
+		{IntItem(7), IntItem(3), nil},
+		{IntItem(-5), IntItem(20), makeRange(0, 10)},
+	} {
+		name := fmt.Sprintf("[%v,%v)", test.lo, test.hi)
+		assertOrder(t, name, test.exp, func(fn func(Item) bool) bool {
+			return root.ascend(test.lo, test.hi, fn)
+		})
+	}
+}
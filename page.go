@@ -0,0 +1,57 @@
+package avl
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// ErrInvalidToken is returned by Page() when continuation token can not be
+// decoded.
+var ErrInvalidToken = errors.New("avl: invalid page token")
+
+// Token is an opaque continuation token returned by Page(). It is safe to be
+// used in URLs. The empty token means the beginning of the tree.
+type Token string
+
+// Page returns up to limit values of the tree which are greater than the
+// value encoded in token after. It returns the values along with the token
+// of the next page, which is empty if there are no more values.
+//
+// The token holds the last returned value encoded with codec, thus the next
+// page is found with a single O(log n) seek even if the tree was modified
+// after the previous page was returned.
+//
+// It panics if limit is not positive.
+func (t Tree) Page(after Token, limit int, codec ItemCodec) (_ []Item, next Token, err error) {
+	if limit <= 0 {
+		panic("avl: non-positive page limit")
+	}
+	it := t.Iter()
+	var last Item
+	if after != "" {
+		p, err := base64.RawURLEncoding.DecodeString(string(after))
+		if err != nil {
+			return nil, "", ErrInvalidToken
+		}
+		if last, err = codec.DecodeItem(p); err != nil {
+			return nil, "", ErrInvalidToken
+		}
+		it.Seek(last)
+	}
+	var items []Item
+	for len(items) < limit && it.Next() {
+		if last != nil && last.Compare(it.Item()) == 0 {
+			// Skip the last value of the previous page.
+			continue
+		}
+		items = append(items, it.Item())
+	}
+	if len(items) == 0 || !it.Next() {
+		return items, "", nil
+	}
+	p, err := codec.EncodeItem(items[len(items)-1])
+	if err != nil {
+		return nil, "", err
+	}
+	return items, Token(base64.RawURLEncoding.EncodeToString(p)), nil
+}
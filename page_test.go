@@ -0,0 +1,73 @@
+package avl
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPage(t *testing.T) {
+	tree := buildTreeFrom(makeRange(0, 10)...)
+	for _, limit := range []int{1, 3, 5, 10, 20} {
+		t.Run(fmt.Sprint(limit), func(t *testing.T) {
+			var (
+				act   []int
+				token Token
+			)
+			for i := 0; ; i++ {
+				items, next, err := tree.Page(token, limit, intCodec{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(items) > limit {
+					t.Fatalf("too many items: %d", len(items))
+				}
+				for _, x := range items {
+					act = append(act, int(x.(IntItem)))
+				}
+				if next == "" {
+					break
+				}
+				if i > 10 {
+					t.Fatalf("too many pages")
+				}
+				token = next
+			}
+			if exp := makeRange(0, 10); fmt.Sprint(act) != fmt.Sprint(exp) {
+				t.Fatalf("unexpected items: %v; want %v", act, exp)
+			}
+		})
+	}
+}
+
+func TestPageModified(t *testing.T) {
+	tree := buildTreeFrom(makeRange(0, 10)...)
+	items, token, err := tree.Page("", 4, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(items) != "[0 1 2 3]" {
+		t.Fatalf("unexpected first page: %v", items)
+	}
+	// Delete the last item of the page and insert new one after it.
+	tree, _ = tree.Delete(IntItem(3))
+	tree, _ = tree.Delete(IntItem(4))
+	tree, _ = tree.Insert(IntItem(-1))
+	if items, _, err = tree.Page(token, 3, intCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(items) != "[5 6 7]" {
+		t.Fatalf("unexpected second page: %v", items)
+	}
+}
+
+func TestPageInvalidToken(t *testing.T) {
+	tree := buildTreeFrom(1, 2, 3)
+	for _, token := range []Token{
+		"!",  // Invalid base64.
+		"gA", // Truncated varint.
+	} {
+		if _, _, err := tree.Page(token, 1, intCodec{}); err != ErrInvalidToken {
+			t.Errorf("unexpected error for %q: %v; want %v", token, err, ErrInvalidToken)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package avl
+
+// PriorityQueue is an immutable min-priority queue of items ordered by their
+// Compare() method. Items comparing equal are ordered by the time they were
+// pushed.
+//
+// Modifying operations return a copy of the queue, which makes snapshots of
+// the queue as cheap as copying its value. The zero value is an empty queue.
+type PriorityQueue struct {
+	tree Tree
+	seq  uint64
+}
+
+// Handle identifies an item pushed to a PriorityQueue.
+// It is valid for queues derived from the queue where it was obtained until
+// the item is popped or removed.
+type Handle struct {
+	item Item
+	seq  uint64
+}
+
+// Item returns the item identified by h.
+func (h Handle) Item() Item {
+	return h.item
+}
+
+// Size returns the number of items in the queue.
+// The time complexity is O(1).
+func (q PriorityQueue) Size() int {
+	return q.tree.Size()
+}
+
+// Push pushes x to the queue.
+// It returns a copy of the queue and the handle of pushed item.
+// The time complexity is O(log n).
+func (q PriorityQueue) Push(x Item) (PriorityQueue, Handle) {
+	q.seq++
+	h := Handle{x, q.seq}
+	q.tree, _ = q.tree.Insert(pqEntry(h))
+	return q, h
+}
+
+// Peek returns the item having minimum priority and its handle. It returns
+// nil item if the queue is empty.
+// The time complexity is O(log n).
+func (q PriorityQueue) Peek() (Item, Handle) {
+	return pqHandle(q.tree.Min())
+}
+
+// Pop deletes the item having minimum priority from the queue.
+// It returns a copy of the queue and the deleted item, which is nil if the
+// queue is empty.
+// The time complexity is O(log n).
+func (q PriorityQueue) Pop() (_ PriorityQueue, x Item) {
+	var e Item
+	q.tree, e = q.tree.PopMin()
+	x, _ = pqHandle(e)
+	return q, x
+}
+
+// Remove removes the item identified by h from the queue.
+// It returns a copy of the queue and false if there is no such item.
+// The time complexity is O(log n).
+func (q PriorityQueue) Remove(h Handle) (_ PriorityQueue, ok bool) {
+	var e Item
+	q.tree, e = q.tree.Delete(pqEntry(h))
+	return q, e != nil
+}
+
+// ChangePriority replaces the item identified by h with x, which usually has
+// different priority. It returns a copy of the queue and a new handle of the
+// item. It returns false if there is no item identified by h.
+// The time complexity is O(log n).
+func (q PriorityQueue) ChangePriority(h Handle, x Item) (_ PriorityQueue, _ Handle, ok bool) {
+	if q, ok = q.Remove(h); !ok {
+		return q, h, false
+	}
+	// Keep the sequence number such that the item stays ahead of the
+	// items pushed after it.
+	h.item = x
+	q.tree, _ = q.tree.Insert(pqEntry(h))
+	return q, h, true
+}
+
+// pqEntry is an item of PriorityQueue tree.
+type pqEntry Handle
+
+func (e pqEntry) Compare(x Item) int {
+	y := x.(pqEntry)
+	if cmp := e.item.Compare(y.item); cmp != 0 {
+		return cmp
+	}
+	switch {
+	case e.seq < y.seq:
+		return -1
+	case e.seq > y.seq:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func pqHandle(e Item) (Item, Handle) {
+	if e == nil {
+		return nil, Handle{}
+	}
+	h := Handle(e.(pqEntry))
+	return h.item, h
+}
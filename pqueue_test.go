@@ -0,0 +1,98 @@
+package avl
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestPriorityQueue(t *testing.T) {
+	var (
+		q  PriorityQueue
+		hs = make(map[int]Handle)
+	)
+	for _, x := range []int{5, 3, 8, 1, 9, 7} {
+		q, hs[x] = q.Push(IntItem(x))
+	}
+	snapshot := q
+
+	q, ok := q.Remove(hs[8])
+	if !ok {
+		t.Fatalf("Remove() failed")
+	}
+	if _, ok := q.Remove(hs[8]); ok {
+		t.Fatalf("Remove() of removed item succeeded")
+	}
+	q, h, ok := q.ChangePriority(hs[9], IntItem(2))
+	if !ok {
+		t.Fatalf("ChangePriority() failed")
+	}
+	if x, ph := q.Peek(); x != IntItem(1) || ph != hs[1] {
+		t.Fatalf("unexpected Peek() result: %v", x)
+	}
+	q, _ = q.Remove(hs[1])
+	if x, ph := q.Peek(); x != IntItem(2) || ph != h {
+		t.Fatalf("unexpected Peek() result: %v", x)
+	}
+	assertQueue(t, q, []int{2, 3, 5, 7})
+	assertQueue(t, snapshot, []int{1, 3, 5, 7, 8, 9})
+}
+
+func TestPriorityQueueStable(t *testing.T) {
+	var q PriorityQueue
+	for i := 0; i < 10; i++ {
+		q, _ = q.Push(record{id: i % 2, created: i})
+	}
+	for i := 0; i < 10; i++ {
+		var x Item
+		q, x = q.Pop()
+		r := x.(record)
+		if exp := i / 5; r.id != exp {
+			t.Fatalf("unexpected priority: %d; want %d", r.id, exp)
+		}
+		if exp := (i%5)*2 + i/5; r.created != exp {
+			t.Fatalf("unexpected order: %d; want %d", r.created, exp)
+		}
+	}
+	if q, x := q.Pop(); x != nil || q.Size() != 0 {
+		t.Fatalf("unexpected Pop() on empty queue: %v", x)
+	}
+}
+
+func TestPriorityQueueRandom(t *testing.T) {
+	var (
+		q   PriorityQueue
+		exp []int
+	)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		if rnd.Intn(3) == 0 && len(exp) > 0 {
+			var x Item
+			q, x = q.Pop()
+			if int(x.(IntItem)) != exp[0] {
+				t.Fatalf("unexpected Pop() result: %v; want %d", x, exp[0])
+			}
+			exp = exp[1:]
+			continue
+		}
+		x := rnd.Intn(100)
+		q, _ = q.Push(IntItem(x))
+		exp = append(exp, x)
+		sort.Ints(exp)
+	}
+	assertQueue(t, q, exp)
+}
+
+func assertQueue(t *testing.T, q PriorityQueue, exp []int) {
+	t.Helper()
+	if q.Size() != len(exp) {
+		t.Fatalf("unexpected queue size: %d; want %d", q.Size(), len(exp))
+	}
+	for i := 0; q.Size() > 0; i++ {
+		var x Item
+		q, x = q.Pop()
+		if act := int(x.(IntItem)); act != exp[i] {
+			t.Fatalf("unexpected #%d item: %d; want %d", i, act, exp[i])
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package avl
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotMerkle is returned when Merkle tree operation is called on a
+	// regular tree.
+	ErrNotMerkle = errors.New("avl: not a Merkle tree")
+
+	// ErrInvalidProof is returned by Verify() when proof does not match the
+	// root hash.
+	ErrInvalidProof = errors.New("avl: invalid proof")
+)
+
+// Proof proves that an item is present or absent in a Merkle tree having
+// some root hash.
+//
+// Proof holds the search path from the root of the tree: the items of the
+// visited nodes along with digests of the subtrees which were not visited.
+// If item is present, the path ends with its node. Otherwise the path ends
+// with an empty subtree where the item would be inserted; since the tree is
+// ordered, the nodes on such path include the in-order predecessor and
+// successor of the absent item (see Bounds()).
+type Proof struct {
+	// Hash is the hash function of the tree.
+	Hash crypto.Hash
+
+	// Item is the encoded item found in the tree or nil if the item is
+	// absent.
+	Item []byte
+
+	// Left and Right are digests of found node's subtrees.
+	Left  []byte
+	Right []byte
+
+	// Path holds the nodes visited before reaching the found node or the
+	// empty subtree, starting from the root.
+	Path []ProofStep
+}
+
+// ProofStep is a node visited during search.
+type ProofStep struct {
+	// Item is the encoded item of the node.
+	Item []byte
+
+	// Left reports whether the search continued to the left subtree.
+	Left bool
+
+	// Sibling is the digest of the subtree not visited by the search.
+	Sibling []byte
+}
+
+// Bounds returns encoded in-order predecessor and successor of the absent
+// item proven by p. Note that any of them is nil if the item is less or
+// greater than all items of the tree.
+func (p *Proof) Bounds() (pred, succ []byte) {
+	for i := len(p.Path) - 1; i >= 0 && (pred == nil || succ == nil); i-- {
+		s := p.Path[i]
+		if s.Left && succ == nil {
+			succ = s.Item
+		}
+		if !s.Left && pred == nil {
+			pred = s.Item
+		}
+	}
+	return pred, succ
+}
+
+// Prove returns a proof of presence or absence of an item equal to x in the
+// Merkle tree t. The proof can be checked without the tree by Verify().
+// The time complexity is O(log n).
+func (t Tree) Prove(x Item) (*Proof, error) {
+	m := t.merkle
+	if m == nil {
+		return nil, ErrNotMerkle
+	}
+	p := &Proof{
+		Hash: m.hash,
+	}
+	for n := t.root; n != nil; {
+		item, err := m.codec.EncodeItem(n.value)
+		if err != nil {
+			return nil, err
+		}
+		cmp := x.Compare(n.value)
+		if cmp == 0 {
+			p.Item = item
+			p.Left = m.digest(n.left)
+			p.Right = m.digest(n.right)
+			break
+		}
+		s := ProofStep{
+			Item: item,
+			Left: cmp < 0,
+		}
+		if s.Left {
+			s.Sibling, n = m.digest(n.right), n.left
+		} else {
+			s.Sibling, n = m.digest(n.left), n.right
+		}
+		p.Path = append(p.Path, s)
+	}
+	return p, nil
+}
+
+// Verify checks that proof p is valid for a Merkle tree having given root
+// hash. Items of the proof are decoded with given codec and compared with x
+// to make sure that p is a proof for x.
+//
+// It returns true if p proves that x is present in the tree and false if it
+// proves that x is absent. It returns ErrInvalidProof if p is not valid.
+func Verify(root []byte, x Item, p *Proof, codec ItemCodec) (found bool, err error) {
+	if !p.Hash.Available() {
+		return false, fmt.Errorf("avl: hash function %v is not available", p.Hash)
+	}
+	var digest []byte
+	if p.Item != nil {
+		y, err := codec.DecodeItem(p.Item)
+		if err != nil {
+			return false, err
+		}
+		if x.Compare(y) != 0 {
+			return false, ErrInvalidProof
+		}
+		digest = nodeDigest(p.Hash, p.Item, p.Left, p.Right)
+	} else {
+		w := p.Hash.New()
+		w.Write([]byte{digestEmpty})
+		digest = w.Sum(nil)
+	}
+	for i := len(p.Path) - 1; i >= 0; i-- {
+		s := p.Path[i]
+		y, err := codec.DecodeItem(s.Item)
+		if err != nil {
+			return false, err
+		}
+		// Make sure the search for x would follow the path.
+		cmp := x.Compare(y)
+		if cmp == 0 || (cmp < 0) != s.Left {
+			return false, ErrInvalidProof
+		}
+		if s.Left {
+			digest = nodeDigest(p.Hash, s.Item, digest, s.Sibling)
+		} else {
+			digest = nodeDigest(p.Hash, s.Item, s.Sibling, digest)
+		}
+	}
+	if !bytes.Equal(digest, root) {
+		return false, ErrInvalidProof
+	}
+	return p.Item != nil, nil
+}
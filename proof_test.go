@@ -0,0 +1,86 @@
+package avl
+
+import (
+	"crypto"
+	"testing"
+)
+
+func TestProveVerify(t *testing.T) {
+	// Tree holds even numbers from 0 to 98.
+	tree := NewMerkle(crypto.SHA256, intCodec{})
+	for i := 0; i < 50; i++ {
+		tree, _ = tree.Insert(IntItem(i * 2))
+	}
+	root := tree.RootHash()
+	for x := -1; x <= 100; x++ {
+		p, err := tree.Prove(IntItem(x))
+		if err != nil {
+			t.Fatal(err)
+		}
+		found, err := Verify(root, IntItem(x), p, intCodec{})
+		if err != nil {
+			t.Fatalf("Verify(%d) error: %v", x, err)
+		}
+		if exp := tree.Search(IntItem(x)) != nil; found != exp {
+			t.Fatalf("unexpected Verify(%d) result: %t; want %t", x, found, exp)
+		}
+		if found {
+			continue
+		}
+		pred, succ := p.Bounds()
+		assertBound(t, "predecessor", pred, tree.Predecessor(IntItem(x)))
+		assertBound(t, "successor", succ, tree.Successor(IntItem(x)))
+	}
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	tree := NewMerkle(crypto.SHA256, intCodec{})
+	for i := 0; i < 10; i++ {
+		tree, _ = tree.Insert(IntItem(i * 2))
+	}
+	root := tree.RootHash()
+
+	p, err := tree.Prove(IntItem(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Proof of presence of 4 must not prove presence of 6.
+	if _, err := Verify(root, IntItem(6), p, intCodec{}); err != ErrInvalidProof {
+		t.Errorf("unexpected error: %v; want %v", err, ErrInvalidProof)
+	}
+	// Proof of absence of 5 must not prove absence of 4.
+	if p, err = tree.Prove(IntItem(5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(root, IntItem(4), p, intCodec{}); err != ErrInvalidProof {
+		t.Errorf("unexpected error: %v; want %v", err, ErrInvalidProof)
+	}
+	// Tampered proof.
+	p.Path[0].Sibling = append([]byte(nil), p.Path[0].Sibling...)
+	p.Path[0].Sibling[0] ^= 0xff
+	if _, err := Verify(root, IntItem(5), p, intCodec{}); err != ErrInvalidProof {
+		t.Errorf("unexpected error: %v; want %v", err, ErrInvalidProof)
+	}
+
+	var plain Tree
+	if _, err := plain.Prove(IntItem(1)); err != ErrNotMerkle {
+		t.Errorf("unexpected error: %v; want %v", err, ErrNotMerkle)
+	}
+}
+
+func assertBound(t *testing.T, name string, act []byte, exp Item) {
+	t.Helper()
+	if exp == nil {
+		if act != nil {
+			t.Errorf("unexpected non-nil %s", name)
+		}
+		return
+	}
+	x, err := intCodec{}.DecodeItem(act)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x != exp {
+		t.Errorf("unexpected %s: %v; want %v", name, x, exp)
+	}
+}
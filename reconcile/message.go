@@ -0,0 +1,129 @@
+package reconcile
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/gobwas/avl"
+)
+
+// Message kinds. Each batch of messages ends with msgEnd.
+const (
+	msgEnd byte = iota
+	msgFingerprint
+	msgItems
+)
+
+const maxBytes = 1 << 30
+
+// fingerprint writes a message with the fingerprint of items within given
+// range of indexes.
+func (s *session) fingerprint(lo, hi avl.Item, i, j int) {
+	s.w.WriteByte(msgFingerprint)
+	s.writeRange(lo, hi)
+	s.writeUvarint(uint64(j - i))
+	s.writeBytes(s.sum(i, j))
+	s.out++
+}
+
+// sendItems writes a message with items within given range of indexes,
+// except those which were received from the remote peer.
+func (s *session) sendItems(lo, hi avl.Item, i, j int, reply bool, skip map[string]bool) {
+	var items [][]byte
+	for _, p := range s.encoded[i:j] {
+		if !skip[string(p)] {
+			items = append(items, p)
+		}
+	}
+	if !reply && len(items) == 0 {
+		return
+	}
+	s.w.WriteByte(msgItems)
+	s.writeRange(lo, hi)
+	if reply {
+		s.w.WriteByte(1)
+	} else {
+		s.w.WriteByte(0)
+	}
+	s.writeUvarint(uint64(len(items)))
+	for _, p := range items {
+		s.writeBytes(p)
+	}
+	s.out++
+}
+
+// flush writes the end of the batch and flushes the buffer. It returns the
+// first error occurred while writing the batch.
+func (s *session) flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	s.w.WriteByte(msgEnd)
+	s.out = 0
+	return s.w.Flush()
+}
+
+// writeRange writes range bounds. Each bound is written as a flag byte
+// followed by the encoded item if the flag is non-zero.
+// Note that write and encoding errors are reported by flush().
+func (s *session) writeRange(lo, hi avl.Item) {
+	for _, x := range [2]avl.Item{lo, hi} {
+		if x == nil {
+			s.w.WriteByte(0)
+			continue
+		}
+		s.w.WriteByte(1)
+		p, err := s.peer.Codec.EncodeItem(x)
+		if err != nil && s.err == nil {
+			s.err = err
+		}
+		s.writeBytes(p)
+	}
+}
+
+func (s *session) readRange() (lo, hi avl.Item, err error) {
+	var bs [2]avl.Item
+	for i := range bs {
+		flag, err := s.r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		if flag == 0 {
+			continue
+		}
+		p, err := s.readBytes()
+		if err != nil {
+			return nil, nil, err
+		}
+		if bs[i], err = s.peer.Codec.DecodeItem(p); err != nil {
+			return nil, nil, err
+		}
+	}
+	return bs[0], bs[1], nil
+}
+
+func (s *session) writeUvarint(x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	s.w.Write(buf[:n])
+}
+
+func (s *session) writeBytes(p []byte) {
+	s.writeUvarint(uint64(len(p)))
+	s.w.Write(p)
+}
+
+func (s *session) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxBytes {
+		return nil, ErrProtocol
+	}
+	p := make([]byte, n)
+	if _, err := io.ReadFull(s.r, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
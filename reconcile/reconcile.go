@@ -0,0 +1,293 @@
+/*
+Package reconcile implements anti-entropy synchronization of two avl.Tree
+instances over a network connection.
+
+Peers compare fingerprints of item ranges top-down: the whole key space is
+compared first, and ranges having different fingerprints are split into
+halves and compared again, until ranges become small enough to exchange
+their items explicitly. That is, the amount of transferred data depends on
+the number of differences rather than on the size of the trees.
+
+Note that since range fingerprints do not depend on the shape of a tree,
+peers may hold trees having different history.
+
+After synchronization both peers hold the union of their items. Items
+present on both sides but having different encodings are resolved with
+Peer.Resolve.
+*/
+package reconcile
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	_ "crypto/sha256" // Default hash function.
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/gobwas/avl"
+)
+
+const defaultThreshold = 16
+
+// ErrProtocol is returned when the remote peer sends a malformed message.
+var ErrProtocol = errors.New("reconcile: protocol error")
+
+// Peer holds synchronization parameters. Both peers must use the same
+// codec, hash function and resolve logic.
+type Peer struct {
+	// Codec is used to encode items for transferring and fingerprinting.
+	Codec avl.ItemCodec
+
+	// Hash is the hash function used for fingerprints.
+	// If zero, crypto.SHA256 is used.
+	Hash crypto.Hash
+
+	// Threshold is the number of items in a range below which peers send
+	// items instead of splitting the range further.
+	// If zero, the default of 16 is used.
+	Threshold int
+
+	// Resolve picks one of two items which are equal in terms of Compare()
+	// but have different encodings. It must give the same result regardless
+	// of the arguments order, so that both peers converge.
+	//
+	// If nil, the item having lexicographically greater encoding is picked.
+	Resolve func(a, b avl.Item) avl.Item
+}
+
+// Initiate starts synchronization of t with the remote peer which must call
+// Respond() on the other side of rw. It returns the synchronized tree.
+func (p *Peer) Initiate(rw io.ReadWriter, t avl.Tree) (avl.Tree, error) {
+	s, err := p.session(rw, t)
+	if err != nil {
+		return t, err
+	}
+	s.fingerprint(nil, nil, 0, len(s.items))
+	return s.run(true)
+}
+
+// Respond serves synchronization of t initiated by remote peer with
+// Initiate(). It returns the synchronized tree.
+func (p *Peer) Respond(rw io.ReadWriter, t avl.Tree) (avl.Tree, error) {
+	s, err := p.session(rw, t)
+	if err != nil {
+		return t, err
+	}
+	return s.run(false)
+}
+
+func (p *Peer) session(rw io.ReadWriter, t avl.Tree) (*session, error) {
+	s := &session{
+		peer:      p,
+		hash:      p.Hash,
+		threshold: p.Threshold,
+		tree:      t,
+		r:         bufio.NewReader(rw),
+		w:         bufio.NewWriter(rw),
+	}
+	if s.hash == 0 {
+		s.hash = crypto.SHA256
+	}
+	if s.threshold <= 0 {
+		s.threshold = defaultThreshold
+	}
+	var err error
+	t.InOrder(func(x avl.Item) bool {
+		var p []byte
+		if p, err = s.peer.Codec.EncodeItem(x); err != nil {
+			return false
+		}
+		s.items = append(s.items, x)
+		s.encoded = append(s.encoded, p)
+		return true
+	})
+	return s, err
+}
+
+// session holds the state of a single synchronization. Note that ranges
+// are computed over the items present in the tree before synchronization.
+type session struct {
+	peer      *Peer
+	hash      crypto.Hash
+	threshold int
+	tree      avl.Tree
+	items     []avl.Item
+	encoded   [][]byte
+	r         *bufio.Reader
+	w         *bufio.Writer
+	out       int
+	err       error // Encoding error reported by flush().
+}
+
+// run exchanges batches of messages until one of the peers has nothing to
+// send.
+func (s *session) run(send bool) (avl.Tree, error) {
+	for {
+		if send {
+			n := s.out
+			if err := s.flush(); err != nil {
+				return s.tree, err
+			}
+			if n == 0 {
+				return s.tree, nil
+			}
+		}
+		n, err := s.receive()
+		if err != nil {
+			return s.tree, err
+		}
+		if n == 0 {
+			return s.tree, nil
+		}
+		send = true
+	}
+}
+
+// receive reads and handles a batch of messages. It returns the number of
+// received messages.
+func (s *session) receive() (n int, err error) {
+	for ; ; n++ {
+		kind, err := s.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		switch kind {
+		case msgEnd:
+			return n, nil
+		case msgFingerprint:
+			err = s.handleFingerprint()
+		case msgItems:
+			err = s.handleItems()
+		default:
+			err = ErrProtocol
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+func (s *session) handleFingerprint() error {
+	lo, hi, err := s.readRange()
+	if err != nil {
+		return err
+	}
+	count, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		return err
+	}
+	sum, err := s.readBytes()
+	if err != nil {
+		return err
+	}
+	i, j := s.bounds(lo, hi)
+	if uint64(j-i) == count && bytes.Equal(s.sum(i, j), sum) {
+		return nil
+	}
+	if j-i <= s.threshold {
+		s.sendItems(lo, hi, i, j, count > 0, nil)
+		return nil
+	}
+	mid := i + (j-i)/2
+	s.fingerprint(lo, s.items[mid], i, mid)
+	s.fingerprint(s.items[mid], hi, mid, j)
+	return nil
+}
+
+func (s *session) handleItems() error {
+	lo, hi, err := s.readRange()
+	if err != nil {
+		return err
+	}
+	reply, err := s.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	n, err := binary.ReadUvarint(s.r)
+	if err != nil {
+		return err
+	}
+	received := make(map[string]bool, n)
+	for k := uint64(0); k < n; k++ {
+		p, err := s.readBytes()
+		if err != nil {
+			return err
+		}
+		x, err := s.peer.Codec.DecodeItem(p)
+		if err != nil {
+			return err
+		}
+		received[string(p)] = true
+		if err := s.merge(x, p); err != nil {
+			return err
+		}
+	}
+	if reply != 0 {
+		i, j := s.bounds(lo, hi)
+		s.sendItems(lo, hi, i, j, false, received)
+	}
+	return nil
+}
+
+// merge merges remote item x having encoding p into the tree.
+func (s *session) merge(x avl.Item, p []byte) error {
+	local := s.tree.Search(x)
+	if local == nil {
+		s.tree, _ = s.tree.Insert(x)
+		return nil
+	}
+	q, err := s.peer.Codec.EncodeItem(local)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(p, q) {
+		return nil
+	}
+	var win avl.Item
+	if s.peer.Resolve != nil {
+		win = s.peer.Resolve(local, x)
+	} else if bytes.Compare(p, q) > 0 {
+		win = x
+	}
+	if win != nil && win != local {
+		s.tree, _ = s.tree.Update(win)
+	}
+	return nil
+}
+
+// bounds returns the range of indexes of items which are greater than or
+// equal to lo and less than hi.
+func (s *session) bounds(lo, hi avl.Item) (i, j int) {
+	i, j = 0, len(s.items)
+	if lo != nil {
+		i = s.lowerBound(lo)
+	}
+	if hi != nil {
+		j = s.lowerBound(hi)
+	}
+	if j < i {
+		j = i
+	}
+	return i, j
+}
+
+func (s *session) lowerBound(x avl.Item) int {
+	return sort.Search(len(s.items), func(i int) bool {
+		return x.Compare(s.items[i]) <= 0
+	})
+}
+
+// sum returns fingerprint of the items within given range of indexes.
+func (s *session) sum(i, j int) []byte {
+	h := s.hash.New()
+	var buf [binary.MaxVarintLen64]byte
+	for _, p := range s.encoded[i:j] {
+		n := binary.PutUvarint(buf[:], uint64(len(p)))
+		h.Write(buf[:n])
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,258 @@
+package reconcile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/gobwas/avl"
+)
+
+func TestSync(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		a, b   []int
+		values map[int][2]string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "one side empty",
+			a:    seq(0, 100),
+		},
+		{
+			name: "equal",
+			a:    seq(0, 1000),
+			b:    seq(0, 1000),
+		},
+		{
+			name: "overlapping",
+			a:    seq(0, 600),
+			b:    seq(400, 1000),
+		},
+		{
+			name: "single difference",
+			a:    seq(0, 1000),
+			b:    append(seq(0, 500), seq(501, 1000)...),
+		},
+		{
+			name: "conflict",
+			a:    seq(0, 100),
+			b:    seq(0, 100),
+			values: map[int][2]string{
+				42: {"a", "b"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a := build(test.a, test.values, 0)
+			b := build(test.b, test.values, 1)
+			a, b, _ = sync(t, a, b)
+
+			exp := union(test.a, test.b)
+			assertItems(t, a, exp)
+			assertItems(t, b, exp)
+			for k, v := range test.values {
+				x := a.Search(item{key: k}).(item)
+				y := b.Search(item{key: k}).(item)
+				if x.value != y.value || x.value != v[1] {
+					t.Errorf("unexpected resolved values: %q and %q", x.value, y.value)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncTraffic(t *testing.T) {
+	a := build(seq(0, 10000), nil, 0)
+	b, _ := a.Delete(item{key: 5000})
+	b, _ = b.Insert(item{key: 20000})
+
+	a, b, n := sync(t, a, b)
+	assertItems(t, a, union(seq(0, 10000), []int{20000}))
+	assertItems(t, b, union(seq(0, 10000), []int{20000}))
+	if n > 10000 {
+		t.Errorf("too many bytes transferred: %d", n)
+	}
+}
+
+func TestSyncStore(t *testing.T) {
+	s, err := avl.OpenStore(filepath.Join(t.TempDir(), "tree"), codec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	v, err := s.Commit(build(seq(0, 300), nil, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := s.Load(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := build(seq(200, 500), nil, 0)
+	a, b, _ = sync(t, a, b)
+	assertItems(t, a, seq(0, 500))
+	assertItems(t, b, seq(0, 500))
+	if _, err := s.Commit(a); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionEncodeError(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		fail = errors.New("encode failed")
+		peer = &Peer{Codec: failingCodec{fail}}
+	)
+	s, err := peer.session(&buf, avl.Tree{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.writeRange(item{key: 1}, nil)
+	if err := s.flush(); err != fail {
+		t.Fatalf("unexpected error: %v; want %v", err, fail)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected %d bytes written", buf.Len())
+	}
+}
+
+func sync(t *testing.T, a, b avl.Tree) (_, _ avl.Tree, n int) {
+	t.Helper()
+	x, y := net.Pipe()
+	cx := &countingConn{ReadWriter: x}
+
+	peer := &Peer{
+		Codec:     codec{},
+		Threshold: 4,
+	}
+	errs := make(chan error, 1)
+	go func() {
+		var err error
+		b, err = peer.Respond(y, b)
+		y.Close()
+		errs <- err
+	}()
+	a, err := peer.Initiate(cx, a)
+	x.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	return a, b, cx.n
+}
+
+type countingConn struct {
+	io.ReadWriter
+	n int
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriter.Read(p)
+	c.n += n
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriter.Write(p)
+	c.n += n
+	return n, err
+}
+
+func build(keys []int, values map[int][2]string, side int) (t avl.Tree) {
+	for _, k := range keys {
+		t, _ = t.Insert(item{
+			key:   k,
+			value: values[k][side],
+		})
+	}
+	return t
+}
+
+func assertItems(t *testing.T, tree avl.Tree, exp []int) {
+	t.Helper()
+	var act []int
+	tree.InOrder(func(x avl.Item) bool {
+		act = append(act, x.(item).key)
+		return true
+	})
+	if fmt.Sprint(act) != fmt.Sprint(exp) {
+		t.Fatalf("unexpected items:\n%v\nwant:\n%v", act, exp)
+	}
+	if tree.Size() != len(exp) {
+		t.Fatalf("unexpected size: %d; want %d", tree.Size(), len(exp))
+	}
+}
+
+func seq(lo, hi int) []int {
+	var xs []int
+	for i := lo; i < hi; i++ {
+		xs = append(xs, i)
+	}
+	return xs
+}
+
+func union(a, b []int) (ret []int) {
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			ret, a = append(ret, a[0]), a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			ret, b = append(ret, b[0]), b[1:]
+		default:
+			ret, a, b = append(ret, a[0]), a[1:], b[1:]
+		}
+	}
+	return ret
+}
+
+type item struct {
+	key   int
+	value string
+}
+
+func (a item) Compare(b avl.Item) int {
+	return a.key - b.(item).key
+}
+
+type codec struct{}
+
+func (codec) EncodeItem(x avl.Item) ([]byte, error) {
+	it := x.(item)
+	p := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(it.value))
+	n := binary.PutVarint(p, int64(it.key))
+	return append(p[:n], it.value...), nil
+}
+
+func (codec) DecodeItem(p []byte) (avl.Item, error) {
+	k, n := binary.Varint(p)
+	if n <= 0 {
+		return nil, errors.New("malformed item")
+	}
+	return item{
+		key:   int(k),
+		value: string(p[n:]),
+	}, nil
+}
+
+type failingCodec struct {
+	err error
+}
+
+func (c failingCodec) EncodeItem(avl.Item) ([]byte, error) {
+	return nil, c.err
+}
+
+func (c failingCodec) DecodeItem([]byte) (avl.Item, error) {
+	return nil, c.err
+}
@@ -0,0 +1,161 @@
+package replication
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"github.com/gobwas/avl"
+)
+
+const (
+	flagSnapshot byte = 1
+	flagDeleted  byte = 1
+)
+
+const maxRecordSize = 1 << 30
+
+// ErrCorrupted is returned by Decoder when a record is malformed.
+var ErrCorrupted = errors.New("replication: corrupted record")
+
+// Encoder writes records to an output stream.
+//
+// Each record is written as uvarint-encoded length, followed by the version,
+// flags, number of changes and the changes themselves, and ends with CRC-32
+// checksum.
+type Encoder struct {
+	w     *bufio.Writer
+	codec avl.ItemCodec
+	buf   []byte
+}
+
+// NewEncoder returns a new Encoder writing to w and encoding items with given
+// codec.
+func NewEncoder(w io.Writer, codec avl.ItemCodec) *Encoder {
+	return &Encoder{
+		w:     bufio.NewWriter(w),
+		codec: codec,
+	}
+}
+
+// Encode writes record r to the stream.
+func (e *Encoder) Encode(r *Record) error {
+	p := e.buf[:0]
+	p = appendUvarint(p, r.Version)
+	if r.Snapshot {
+		p = append(p, flagSnapshot)
+	} else {
+		p = append(p, 0)
+	}
+	p = appendUvarint(p, uint64(len(r.Changes)))
+	for _, c := range r.Changes {
+		if c.Deleted {
+			p = append(p, flagDeleted)
+		} else {
+			p = append(p, 0)
+		}
+		item, err := e.codec.EncodeItem(c.Item)
+		if err != nil {
+			return err
+		}
+		p = appendUvarint(p, uint64(len(item)))
+		p = append(p, item...)
+	}
+	e.buf = p
+
+	var head [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(head[:], uint64(len(p)))
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(p))
+	e.w.Write(head[:n])
+	e.w.Write(p)
+	e.w.Write(sum[:])
+	return e.w.Flush()
+}
+
+// Decoder reads records from an input stream.
+type Decoder struct {
+	r     *bufio.Reader
+	codec avl.ItemCodec
+}
+
+// NewDecoder returns a new Decoder reading from r and decoding items with
+// given codec.
+func NewDecoder(r io.Reader, codec avl.ItemCodec) *Decoder {
+	return &Decoder{
+		r:     bufio.NewReader(r),
+		codec: codec,
+	}
+}
+
+// Decode reads the next record from the stream.
+func (d *Decoder) Decode() (*Record, error) {
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxRecordSize {
+		return nil, ErrCorrupted
+	}
+	p := make([]byte, n+4)
+	if _, err := io.ReadFull(d.r, p); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(p[:n]) != binary.LittleEndian.Uint32(p[n:]) {
+		return nil, ErrCorrupted
+	}
+	p = p[:n]
+
+	var r Record
+	if r.Version, p, err = readUvarint(p); err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, ErrCorrupted
+	}
+	r.Snapshot, p = p[0]&flagSnapshot != 0, p[1:]
+	count, p, err := readUvarint(p)
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(p)) {
+		return nil, ErrCorrupted
+	}
+	r.Changes = make([]Change, count)
+	for i := range r.Changes {
+		if len(p) == 0 {
+			return nil, ErrCorrupted
+		}
+		c := &r.Changes[i]
+		c.Deleted, p = p[0]&flagDeleted != 0, p[1:]
+
+		var size uint64
+		if size, p, err = readUvarint(p); err != nil {
+			return nil, err
+		}
+		if size > uint64(len(p)) {
+			return nil, ErrCorrupted
+		}
+		if c.Item, err = d.codec.DecodeItem(p[:size]); err != nil {
+			return nil, err
+		}
+		p = p[size:]
+	}
+	return &r, nil
+}
+
+func appendUvarint(p []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	return append(p, buf[:n]...)
+}
+
+func readUvarint(p []byte) (uint64, []byte, error) {
+	x, n := binary.Uvarint(p)
+	if n <= 0 {
+		return 0, nil, ErrCorrupted
+	}
+	return x, p[n:], nil
+}
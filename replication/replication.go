@@ -0,0 +1,174 @@
+/*
+Package replication implements shipping of changes from a primary avl.Tree to
+its read replicas (followers).
+
+Each commit on the primary produces a Record holding the changes between the
+previous and the committed versions of the tree. Changes are computed with
+avl.Diff(), which skips the subtrees shared by consecutive versions, so the
+cost of a commit depends on the number of changes rather than on the size of
+the tree. Records are numbered sequentially, which lets followers detect
+missed records and resynchronize from a full snapshot record.
+*/
+package replication
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/gobwas/avl"
+)
+
+// ErrGap is returned by Follower when the applied record is not the next one
+// after the last applied record. Follower must be resynchronized with a
+// snapshot record after this error.
+var ErrGap = errors.New("replication: gap in records")
+
+// Change is a change of a single item.
+type Change struct {
+	// Item is the inserted or updated item; or the deleted one if Deleted is
+	// true.
+	Item avl.Item
+
+	// Deleted reports whether the item was deleted.
+	Deleted bool
+}
+
+// Record holds changes of a tree made by a single commit on the primary.
+type Record struct {
+	// Version is the version of the tree after the changes are applied.
+	Version uint64
+
+	// Snapshot reports whether the record holds the whole tree, that is, all
+	// its items as changes.
+	Snapshot bool
+
+	Changes []Change
+}
+
+// Primary produces records for each committed version of a tree.
+// It is safe for concurrent use.
+type Primary struct {
+	mu      sync.Mutex
+	tree    avl.Tree
+	version uint64
+}
+
+// NewPrimary creates a new Primary holding an empty tree of version zero.
+func NewPrimary() *Primary {
+	return new(Primary)
+}
+
+// Commit makes t the current version of the tree and returns a record with
+// the changes made since the previous version.
+func (p *Primary) Commit(t avl.Tree) *Record {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := &Record{
+		Version: p.version + 1,
+	}
+	avl.Diff(p.tree, t, func(x, y avl.Item) bool {
+		if y == nil {
+			r.Changes = append(r.Changes, Change{Item: x, Deleted: true})
+		} else {
+			r.Changes = append(r.Changes, Change{Item: y})
+		}
+		return true
+	})
+	p.tree = t
+	p.version++
+
+	return r
+}
+
+// Snapshot returns a snapshot record of the current version of the tree.
+func (p *Primary) Snapshot() *Record {
+	p.mu.Lock()
+	t, v := p.tree, p.version
+	p.mu.Unlock()
+
+	r := &Record{
+		Version:  v,
+		Snapshot: true,
+		Changes:  make([]Change, 0, t.Size()),
+	}
+	t.InOrder(func(x avl.Item) bool {
+		r.Changes = append(r.Changes, Change{Item: x})
+		return true
+	})
+	return r
+}
+
+// Tree returns the current version of the tree and its number.
+func (p *Primary) Tree() (avl.Tree, uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tree, p.version
+}
+
+// Follower applies records produced by Primary to its own tree.
+// It is safe for concurrent use.
+type Follower struct {
+	mu      sync.RWMutex
+	tree    avl.Tree
+	version uint64
+}
+
+// Apply applies record r to the follower's tree. Records of already applied
+// versions as well as snapshots older than the current version are ignored.
+// It returns ErrGap if r is not the next record after the last applied one
+// and is not a snapshot.
+func (f *Follower) Apply(r *Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Snapshot {
+		if r.Version < f.version {
+			return nil
+		}
+		var t avl.Tree
+		for _, c := range r.Changes {
+			t, _ = t.Insert(c.Item)
+		}
+		f.tree, f.version = t, r.Version
+		return nil
+	}
+	if r.Version <= f.version {
+		return nil
+	}
+	if r.Version != f.version+1 {
+		return ErrGap
+	}
+	t := f.tree
+	for _, c := range r.Changes {
+		if c.Deleted {
+			t, _ = t.Delete(c.Item)
+		} else {
+			t, _ = t.Update(c.Item)
+		}
+	}
+	f.tree, f.version = t, r.Version
+	return nil
+}
+
+// Follow reads records from d and applies them until an error occurs.
+// It returns ErrGap if a record is missed in the stream, or the error
+// returned by d.
+func (f *Follower) Follow(d *Decoder) error {
+	for {
+		r, err := d.Decode()
+		if err != nil {
+			return err
+		}
+		if err := f.Apply(r); err != nil {
+			return err
+		}
+	}
+}
+
+// Tree returns the follower's tree and its version.
+func (f *Follower) Tree() (avl.Tree, uint64) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.tree, f.version
+}
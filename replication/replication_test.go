@@ -0,0 +1,141 @@
+package replication
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/gobwas/avl"
+)
+
+func TestShipping(t *testing.T) {
+	pr, pw := io.Pipe()
+	var (
+		primary  = NewPrimary()
+		follower Follower
+		enc      = NewEncoder(pw, codec{})
+		done     = make(chan error, 1)
+	)
+	go func() {
+		done <- follower.Follow(NewDecoder(pr, codec{}))
+	}()
+
+	rnd := rand.New(rand.NewSource(42))
+	var tree avl.Tree
+	for i := 0; i < 100; i++ {
+		for j := rnd.Intn(10); j >= 0; j-- {
+			x := item{key: rnd.Intn(100), value: i}
+			if rnd.Intn(3) == 0 {
+				tree, _ = tree.Delete(x)
+			} else {
+				tree, _ = tree.Update(x)
+			}
+		}
+		if err := enc.Encode(primary.Commit(tree)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pw.Close()
+	if err := <-done; err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	act, v := follower.Tree()
+	if v != 100 {
+		t.Fatalf("unexpected version: %d; want %d", v, 100)
+	}
+	assertEqual(t, act, tree)
+}
+
+func TestGap(t *testing.T) {
+	var (
+		primary  = NewPrimary()
+		follower Follower
+		tree     avl.Tree
+		records  []*Record
+		stale    *Record
+	)
+	for i := 0; i < 5; i++ {
+		tree, _ = tree.Insert(item{key: i})
+		records = append(records, primary.Commit(tree))
+		if i == 1 {
+			stale = primary.Snapshot()
+		}
+	}
+	if err := follower.Apply(records[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := follower.Apply(records[2]); err != ErrGap {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrGap)
+	}
+	// Resync from the snapshot.
+	if err := follower.Apply(primary.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	// Already applied records must be ignored.
+	if err := follower.Apply(records[3]); err != nil {
+		t.Fatal(err)
+	}
+	tree, _ = tree.Delete(item{key: 0})
+	if err := follower.Apply(primary.Commit(tree)); err != nil {
+		t.Fatal(err)
+	}
+	// Stale snapshots must be ignored as well.
+	if err := follower.Apply(stale); err != nil {
+		t.Fatal(err)
+	}
+	act, v := follower.Tree()
+	if v != 6 {
+		t.Fatalf("unexpected version: %d; want %d", v, 6)
+	}
+	assertEqual(t, act, tree)
+}
+
+func assertEqual(t *testing.T, act, exp avl.Tree) {
+	t.Helper()
+	if a, b := dump(act), dump(exp); a != b {
+		t.Fatalf("trees differ:\n%s\nwant:\n%s", a, b)
+	}
+}
+
+func dump(t avl.Tree) string {
+	var xs []item
+	t.InOrder(func(x avl.Item) bool {
+		xs = append(xs, x.(item))
+		return true
+	})
+	return fmt.Sprint(xs)
+}
+
+type item struct {
+	key   int
+	value int
+}
+
+func (a item) Compare(b avl.Item) int {
+	return a.key - b.(item).key
+}
+
+type codec struct{}
+
+func (codec) EncodeItem(x avl.Item) ([]byte, error) {
+	it := x.(item)
+	p := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutVarint(p, int64(it.key))
+	n += binary.PutVarint(p[n:], int64(it.value))
+	return p[:n], nil
+}
+
+func (codec) DecodeItem(p []byte) (avl.Item, error) {
+	k, n := binary.Varint(p)
+	if n <= 0 {
+		return nil, errors.New("malformed item")
+	}
+	v, m := binary.Varint(p[n:])
+	if m <= 0 {
+		return nil, errors.New("malformed item")
+	}
+	return item{key: int(k), value: int(v)}, nil
+}
@@ -0,0 +1,59 @@
+package avl
+
+// SearchFunc searches for a value for which cmp returns zero.
+//
+// cmp is called with values of the tree and must be consistent with the tree
+// order, as if it was the Compare() method of a searched item. That is, it
+// returns negative value if the searched item is less than the given value,
+// positive value if it is greater and zero if they are equal.
+func (t Tree) SearchFunc(cmp func(Item) int) Item {
+	return t.root.Search(itemFunc(cmp))
+}
+
+// PredecessorFunc returns the greatest value for which cmp returns positive
+// value. See SearchFunc() for cmp requirements.
+func (t Tree) PredecessorFunc(cmp func(Item) int) Item {
+	return t.root.Predecessor(itemFunc(cmp))
+}
+
+// SuccessorFunc returns the least value for which cmp returns negative value.
+// See SearchFunc() for cmp requirements.
+func (t Tree) SuccessorFunc(cmp func(Item) int) Item {
+	return t.root.Successor(itemFunc(cmp))
+}
+
+// FindFirst returns the least value for which pred returns true.
+//
+// pred must be monotone in the tree order: if it returns true for some value
+// it must return true for all greater values. This is the same requirement
+// as for sort.Search().
+// The time complexity is O(log n).
+func (t Tree) FindFirst(pred func(Item) bool) Item {
+	return t.root.Ceiling(itemFunc(func(x Item) int {
+		if pred(x) {
+			return -1
+		}
+		return 1
+	}))
+}
+
+// FindLast returns the greatest value for which pred returns true.
+//
+// pred must be monotone in the tree order: if it returns true for some value
+// it must return true for all lesser values.
+// The time complexity is O(log n).
+func (t Tree) FindLast(pred func(Item) bool) Item {
+	return t.root.last(itemFunc(func(x Item) int {
+		if pred(x) {
+			return 1
+		}
+		return 0
+	}))
+}
+
+// itemFunc is an adapter to use comparison function as a lookup Item.
+type itemFunc func(Item) int
+
+func (f itemFunc) Compare(x Item) int {
+	return f(x)
+}
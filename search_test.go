@@ -0,0 +1,68 @@
+package avl
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSearchFunc(t *testing.T) {
+	// Tree holds records with even ids from 0 to 18.
+	var (
+		tree Tree
+		ids  []int
+	)
+	for i := 0; i < 10; i++ {
+		tree, _ = tree.Insert(record{id: i * 2})
+		ids = append(ids, i*2)
+	}
+	find := func(fn func(int) bool) int {
+		for _, id := range ids {
+			if fn(id) {
+				return id
+			}
+		}
+		return -1
+	}
+	findLast := func(fn func(int) bool) int {
+		for i := len(ids) - 1; i >= 0; i-- {
+			if fn(ids[i]) {
+				return ids[i]
+			}
+		}
+		return -1
+	}
+	for x := -1; x <= 20; x++ {
+		cmp := func(y Item) int {
+			return x - y.(record).id
+		}
+		assertRecord(t, fmt.Sprintf("SearchFunc(%d)", x), tree.SearchFunc(cmp),
+			find(func(id int) bool { return id == x }))
+		assertRecord(t, fmt.Sprintf("PredecessorFunc(%d)", x), tree.PredecessorFunc(cmp),
+			findLast(func(id int) bool { return id < x }))
+		assertRecord(t, fmt.Sprintf("SuccessorFunc(%d)", x), tree.SuccessorFunc(cmp),
+			find(func(id int) bool { return id > x }))
+
+		first := tree.FindFirst(func(y Item) bool {
+			return y.(record).id >= x
+		})
+		assertRecord(t, fmt.Sprintf("FindFirst(>=%d)", x), first,
+			find(func(id int) bool { return id >= x }))
+
+		last := tree.FindLast(func(y Item) bool {
+			return y.(record).id <= x
+		})
+		assertRecord(t, fmt.Sprintf("FindLast(<=%d)", x), last,
+			findLast(func(id int) bool { return id <= x }))
+	}
+}
+
+// assertRecord checks that act is a record having given id. Negative id
+// means that act must be nil.
+func assertRecord(t *testing.T, name string, act Item, id int) {
+	t.Helper()
+	switch {
+	case act == nil && id < 0:
+	case act == nil || id < 0 || act.(record).id != id:
+		t.Errorf("unexpected %s result: %v; want %d", name, act, id)
+	}
+}
@@ -0,0 +1,101 @@
+package avl
+
+// DeleteRange deletes values greater than or equal to lo and less than hi
+// from the tree. Nil lo or hi means no lower or upper bound respectively.
+// It returns a copy of the tree and a tree holding the deleted values.
+//
+// Both trees share untouched subtrees with t. The time complexity is
+// O(log n + k), where k is the number of deleted values.
+func (t Tree) DeleteRange(lo, hi Item) (_ Tree, removed Tree) {
+	l, m, r := t.root.splitRange(lo, hi)
+	if m == nil {
+		// Nothing to delete; leave t as is.
+		return t, Tree{merkle: t.merkle}
+	}
+	removed = Tree{
+		root:   t.merkle.rehash(m),
+		size:   m.Size(),
+		merkle: t.merkle,
+	}
+	t.root = join2(l, r)
+	t.size -= removed.size
+	t.root = t.merkle.rehash(t.root)
+	return t, removed
+}
+
+// Slice returns a tree holding values greater than or equal to lo and less
+// than hi. Nil lo or hi means no lower or upper bound respectively.
+//
+// Returned tree shares untouched subtrees with t. The time complexity is
+// O(log n + k), where k is the number of values in range.
+func (t Tree) Slice(lo, hi Item) Tree {
+	_, m, _ := t.root.splitRange(lo, hi)
+	t.root = m
+	t.size = m.Size()
+	t.root = t.merkle.rehash(t.root)
+	return t
+}
+
+// splitRange splits the tree into trees holding values less than lo, values
+// in range [lo, hi) and values greater than or equal to hi.
+func (n *node) splitRange(lo, hi Item) (l, m, r *node) {
+	m = n
+	if lo != nil {
+		l, m = m.split(lo)
+	}
+	if hi != nil {
+		m, r = m.split(hi)
+	}
+	return l, m, r
+}
+
+// split splits the tree into trees holding values less than x and values
+// greater than or equal to x.
+func (n *node) split(x Item) (l, r *node) {
+	if n == nil {
+		return nil, nil
+	}
+	if x.Compare(n.value) > 0 {
+		rl, rr := n.right.split(x)
+		return join(n.left, n.value, rl), rr
+	}
+	ll, lr := n.left.split(x)
+	return ll, join(lr, n.value, n.right)
+}
+
+// join returns a tree holding values of l, x and values of r. All values of
+// l must be less than x and all values of r must be greater than x.
+// The time complexity is O(|l.h - r.h| + 1).
+func join(l *node, x Item, r *node) (root *node) {
+	switch hl, hr := l.height(), r.height(); {
+	case hl > hr+1:
+		root = l.clone()
+		root.right = join(l.right, x, r)
+	case hr > hl+1:
+		root = r.clone()
+		root.left = join(l, x, r.left)
+	default:
+		root = &node{
+			value: x,
+			left:  l,
+			right: r,
+		}
+	}
+
+	root.adjustHeight()
+
+	return root.rebalance()
+}
+
+// join2 returns a tree holding values of l and r. All values of l must be
+// less than values of r.
+func join2(l, r *node) *node {
+	if l == nil {
+		return r
+	}
+	if r == nil {
+		return l
+	}
+	r, x := r.PopMin()
+	return join(l, x, r)
+}
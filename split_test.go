@@ -0,0 +1,81 @@
+package avl
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestDeleteRange(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for i := 0; i < 200; i++ {
+		var (
+			n  = rnd.Intn(100)
+			xs = makeRange(0, n)
+			lo = rnd.Intn(n+20) - 10
+			hi = rnd.Intn(n+20) - 10
+		)
+		tree := NewMerkle(crypto.SHA256, intCodec{})
+		for _, j := range rnd.Perm(n) {
+			tree, _ = tree.Insert(IntItem(j))
+		}
+		for _, bounds := range []struct {
+			lo, hi Item
+		}{
+			{IntItem(lo), IntItem(hi)},
+			{nil, IntItem(hi)},
+			{IntItem(lo), nil},
+			{nil, nil},
+		} {
+			name := fmt.Sprintf("n=%d [%v,%v)", n, bounds.lo, bounds.hi)
+			t.Run(name, func(t *testing.T) {
+				var in, out []int
+				for _, x := range xs {
+					if inRange(x, bounds.lo, bounds.hi) {
+						in = append(in, x)
+					} else {
+						out = append(out, x)
+					}
+				}
+				rest, removed := tree.DeleteRange(bounds.lo, bounds.hi)
+				assertTree(t, rest, out)
+				assertTree(t, removed, in)
+				assertTree(t, tree.Slice(bounds.lo, bounds.hi), in)
+				assertTree(t, tree, xs)
+			})
+		}
+	}
+}
+
+func TestDeleteRangeEmpty(t *testing.T) {
+	tree := buildTreeFrom(makeRange(0, 10)...)
+	rest, removed := tree.DeleteRange(IntItem(20), nil)
+	if rest.root != tree.root {
+		t.Fatalf("tree is modified")
+	}
+	if removed.Size() != 0 || removed.root != nil {
+		t.Fatalf("unexpected removed items")
+	}
+}
+
+func inRange(x int, lo, hi Item) bool {
+	return (lo == nil || int(lo.(IntItem)) <= x) &&
+		(hi == nil || x < int(hi.(IntItem)))
+}
+
+func assertTree(t *testing.T, tree Tree, exp []int) {
+	t.Helper()
+	assertInOrder(t, tree.root, exp)
+	assertBalanced(t, tree.root)
+	if tree.Size() != len(exp) {
+		t.Fatalf("unexpected size: %d; want %d", tree.Size(), len(exp))
+	}
+	if m := tree.merkle; m != nil {
+		exp := fullDigest(m, tree.root)
+		if act := tree.RootHash(); !bytes.Equal(act, exp) {
+			t.Fatalf("unexpected root hash")
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package sstable
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// buildFilter builds a Bloom filter for given key hashes.
+// The last byte of the filter holds the number of probes.
+func buildFilter(hashes []uint64, bitsPerKey int) []byte {
+	k := int(math.Round(float64(bitsPerKey) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	if k > 30 {
+		k = 30
+	}
+	bits := len(hashes) * bitsPerKey
+	if bits < 64 {
+		bits = 64
+	}
+	n := (bits + 7) / 8
+	bits = n * 8
+
+	filter := make([]byte, n+1)
+	for _, h := range hashes {
+		h1, h2 := uint32(h), uint32(h>>32)
+		for i := 0; i < k; i++ {
+			b := (h1 + uint32(i)*h2) % uint32(bits)
+			filter[b/8] |= 1 << (b % 8)
+		}
+	}
+	filter[n] = byte(k)
+
+	return filter
+}
+
+// filterMayContain reports whether the key having hash h may be present in
+// the filter built by buildFilter().
+func filterMayContain(filter []byte, h uint64) bool {
+	if len(filter) < 2 {
+		return true
+	}
+	n := len(filter) - 1
+	k := int(filter[n])
+	bits := uint32(n * 8)
+	h1, h2 := uint32(h), uint32(h>>32)
+	for i := 0; i < k; i++ {
+		b := (h1 + uint32(i)*h2) % bits
+		if filter[b/8]&(1<<(b%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func hash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
@@ -0,0 +1,354 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/gobwas/avl"
+)
+
+// ErrCorrupted is returned by Reader when the table file is malformed.
+var ErrCorrupted = errors.New("sstable: corrupted table")
+
+// Reader reads a table written by Writer.
+//
+// Reader holds the index and filter blocks in memory, while data blocks are
+// read from the underlying io.ReaderAt on demand. That is, each lookup costs
+// a single data block read.
+//
+// Reader is safe for concurrent use if the underlying io.ReaderAt is.
+type Reader struct {
+	r      io.ReaderAt
+	codec  avl.ItemCodec
+	opts   *Options
+	blocks []blockHandle
+	filter []byte
+	count  int
+}
+
+type blockHandle struct {
+	first avl.Item
+	off   int64
+	size  int64
+}
+
+// Open opens a table of given size which is read from r.
+// Options are expected to be the same as given to the Writer which produced
+// the table.
+func Open(r io.ReaderAt, size int64, codec avl.ItemCodec, opts *Options) (*Reader, error) {
+	if size < int64(footerSize) {
+		return nil, ErrCorrupted
+	}
+	var footer [footerSize]byte
+	if _, err := r.ReadAt(footer[:], size-int64(footerSize)); err != nil {
+		return nil, err
+	}
+	if string(footer[48:]) != magic {
+		return nil, ErrCorrupted
+	}
+	var (
+		indexOff  = int64(binary.LittleEndian.Uint64(footer[0:]))
+		indexLen  = int64(binary.LittleEndian.Uint64(footer[8:]))
+		filterOff = int64(binary.LittleEndian.Uint64(footer[16:]))
+		filterLen = int64(binary.LittleEndian.Uint64(footer[24:]))
+		count     = int64(binary.LittleEndian.Uint64(footer[32:]))
+		indexSum  = binary.LittleEndian.Uint32(footer[40:])
+		filterSum = binary.LittleEndian.Uint32(footer[44:])
+	)
+	data := size - int64(footerSize)
+	if !inside(indexOff, indexLen, data) || !inside(filterOff, filterLen, data) {
+		return nil, ErrCorrupted
+	}
+	index, err := readBlock(r, indexOff, indexLen, indexSum)
+	if err != nil {
+		return nil, err
+	}
+	t := &Reader{
+		r:     r,
+		codec: codec,
+		opts:  opts,
+		count: int(count),
+	}
+	if err := t.parseIndex(index, indexOff); err != nil {
+		return nil, err
+	}
+	if filterLen > 0 && opts.filterKey() != nil {
+		t.filter, err = readBlock(r, filterOff, filterLen, filterSum)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func inside(off, size, limit int64) bool {
+	return off >= 0 && size >= 0 && off+size <= limit
+}
+
+func (t *Reader) parseIndex(p []byte, limit int64) error {
+	n, m := binary.Uvarint(p)
+	if m <= 0 || n > uint64(len(p)) {
+		return ErrCorrupted
+	}
+	p = p[m:]
+	t.blocks = make([]blockHandle, n)
+	for i := range t.blocks {
+		first, rest, err := readBytes(p)
+		if err != nil {
+			return err
+		}
+		off, m1 := binary.Uvarint(rest)
+		if m1 <= 0 {
+			return ErrCorrupted
+		}
+		size, m2 := binary.Uvarint(rest[m1:])
+		if m2 <= 0 {
+			return ErrCorrupted
+		}
+		if !inside(int64(off), int64(size), limit) {
+			return ErrCorrupted
+		}
+		x, err := t.codec.DecodeItem(first)
+		if err != nil {
+			return err
+		}
+		t.blocks[i] = blockHandle{
+			first: x,
+			off:   int64(off),
+			size:  int64(size),
+		}
+		p = rest[m1+m2:]
+	}
+	return nil
+}
+
+// Len returns the number of items in the table.
+func (t *Reader) Len() int {
+	return t.count
+}
+
+// Min returns min item of the table.
+func (t *Reader) Min() avl.Item {
+	if len(t.blocks) == 0 {
+		return nil
+	}
+	return t.blocks[0].first
+}
+
+// Max returns max item of the table.
+func (t *Reader) Max() (avl.Item, error) {
+	if len(t.blocks) == 0 {
+		return nil, nil
+	}
+	items, err := t.readItems(len(t.blocks) - 1)
+	if err != nil {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+// Search searches for an item equal to x and returns it.
+// If the table has a filter, it is checked first and no data block is read if
+// x is definitely not present.
+func (t *Reader) Search(x avl.Item) (avl.Item, error) {
+	if t.filter != nil {
+		if !filterMayContain(t.filter, hash(t.opts.FilterKey(x))) {
+			return nil, nil
+		}
+	}
+	b := t.blockFor(x)
+	if b < 0 {
+		return nil, nil
+	}
+	items, err := t.readItems(b)
+	if err != nil {
+		return nil, err
+	}
+	i := lowerBound(items, x)
+	if i < len(items) && x.Compare(items[i]) == 0 {
+		return items[i], nil
+	}
+	return nil, nil
+}
+
+// Predecessor returns the greatest item less than x or nil.
+func (t *Reader) Predecessor(x avl.Item) (avl.Item, error) {
+	b := t.blockFor(x)
+	if b < 0 {
+		return nil, nil
+	}
+	items, err := t.readItems(b)
+	if err != nil {
+		return nil, err
+	}
+	if i := lowerBound(items, x); i > 0 {
+		return items[i-1], nil
+	}
+	if b == 0 {
+		return nil, nil
+	}
+	// The first item of the block is equal to x.
+	if items, err = t.readItems(b - 1); err != nil {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+// Successor returns the least item greater than x or nil.
+func (t *Reader) Successor(x avl.Item) (avl.Item, error) {
+	it := t.Seek(x)
+	for it.Next() {
+		if y := it.Item(); x.Compare(y) < 0 {
+			return y, nil
+		}
+	}
+	return nil, it.Err()
+}
+
+// Range calls fn with each item greater than or equal to lo and less than hi
+// in order. Nil lo or hi means no lower or upper bound respectively. If fn
+// returns false it stops iteration.
+func (t *Reader) Range(lo, hi avl.Item, fn func(avl.Item) bool) error {
+	it := t.Seek(lo)
+	for it.Next() {
+		x := it.Item()
+		if hi != nil && hi.Compare(x) <= 0 {
+			break
+		}
+		if !fn(x) {
+			break
+		}
+	}
+	return it.Err()
+}
+
+// Seek returns an iterator positioned before the first item greater than or
+// equal to x. Nil x means the very first item of the table.
+func (t *Reader) Seek(x avl.Item) *Iterator {
+	it := &Iterator{
+		t:     t,
+		block: 0,
+	}
+	if x != nil {
+		if b := t.blockFor(x); b > 0 {
+			it.block = b
+		}
+		it.seek = x
+	}
+	return it
+}
+
+// blockFor returns the index of the last block having the first item less
+// than or equal to x. It returns -1 if x is less than any item.
+func (t *Reader) blockFor(x avl.Item) int {
+	i := sort.Search(len(t.blocks), func(i int) bool {
+		return x.Compare(t.blocks[i].first) < 0
+	})
+	return i - 1
+}
+
+func (t *Reader) readItems(b int) ([]avl.Item, error) {
+	h := t.blocks[b]
+	p, err := readBlock(t.r, h.off, h.size, 0)
+	if err != nil {
+		return nil, err
+	}
+	var items []avl.Item
+	for len(p) > 0 {
+		var x []byte
+		if x, p, err = readBytes(p); err != nil {
+			return nil, err
+		}
+		item, err := t.codec.DecodeItem(x)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, ErrCorrupted
+	}
+	return items, nil
+}
+
+// Iterator iterates over items of a table in order.
+type Iterator struct {
+	t     *Reader
+	block int
+	items []avl.Item
+	pos   int
+	seek  avl.Item
+	err   error
+}
+
+// Next moves iterator to the next item. It returns false when there are no
+// more items or an error occurred.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.pos++
+	for it.pos >= len(it.items) {
+		if it.block >= len(it.t.blocks) {
+			it.items = nil
+			return false
+		}
+		it.items, it.err = it.t.readItems(it.block)
+		if it.err != nil {
+			return false
+		}
+		it.block++
+		it.pos = 0
+		if it.seek != nil {
+			it.pos = lowerBound(it.items, it.seek)
+			it.seek = nil
+		}
+	}
+	return true
+}
+
+// Item returns current item.
+func (it *Iterator) Item() avl.Item {
+	return it.items[it.pos]
+}
+
+// Err returns an error occurred during iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// readBlock reads a block of given size and verifies its trailing checksum.
+// If sum is non-zero it also must be equal to the trailing checksum.
+func readBlock(r io.ReaderAt, off, size int64, sum uint32) ([]byte, error) {
+	if size < 4 {
+		return nil, ErrCorrupted
+	}
+	p := make([]byte, size)
+	if _, err := r.ReadAt(p, off); err != nil {
+		return nil, fmt.Errorf("sstable: read block at %d: %w", off, err)
+	}
+	n := len(p) - 4
+	act := crc32.ChecksumIEEE(p[:n])
+	if exp := binary.LittleEndian.Uint32(p[n:]); act != exp || (sum != 0 && sum != act) {
+		return nil, ErrCorrupted
+	}
+	return p[:n], nil
+}
+
+func readBytes(p []byte) (b, rest []byte, err error) {
+	n, m := binary.Uvarint(p)
+	if m <= 0 || n > uint64(len(p)-m) {
+		return nil, nil, ErrCorrupted
+	}
+	return p[m : m+int(n)], p[m+int(n):], nil
+}
+
+func lowerBound(items []avl.Item, x avl.Item) int {
+	return sort.Search(len(items), func(i int) bool {
+		return x.Compare(items[i]) <= 0
+	})
+}
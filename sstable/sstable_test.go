@@ -0,0 +1,172 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/gobwas/avl"
+)
+
+func TestReader(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		opts *Options
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "small blocks",
+			opts: &Options{
+				BlockSize: 16,
+			},
+		},
+		{
+			name: "filter",
+			opts: &Options{
+				BlockSize: 64,
+				FilterKey: func(x avl.Item) []byte {
+					b, _ := intCodec{}.EncodeItem(x)
+					return b
+				},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			// Table holds even numbers from 0 to 998.
+			var tree avl.Tree
+			for i := 0; i < 500; i++ {
+				tree, _ = tree.Insert(intItem(i * 2))
+			}
+			r := writeTable(t, tree, test.opts)
+			if act, exp := r.Len(), tree.Size(); act != exp {
+				t.Fatalf("unexpected Len(): %d; want %d", act, exp)
+			}
+			if act, exp := r.Min(), tree.Min(); act != exp {
+				t.Errorf("unexpected Min(): %v; want %v", act, exp)
+			}
+			if act, err := r.Max(); err != nil || act != tree.Max() {
+				t.Errorf("unexpected Max(): %v (%v); want %v", act, err, tree.Max())
+			}
+			for x := -1; x <= 1000; x++ {
+				mustEqual(t, "Search", x, tree.Search, r.Search)
+				mustEqual(t, "Predecessor", x, tree.Predecessor, r.Predecessor)
+				mustEqual(t, "Successor", x, tree.Successor, r.Successor)
+			}
+			var act []int
+			err := r.Range(intItem(99), intItem(110), func(x avl.Item) bool {
+				act = append(act, int(x.(intItem)))
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := []int{100, 102, 104, 106, 108}; !equalInts(act, exp) {
+				t.Errorf("unexpected Range() result: %v; want %v", act, exp)
+			}
+		})
+	}
+}
+
+func TestWriterOrder(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, intCodec{}, nil)
+	if err := w.Add(intItem(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(intItem(1)); err != ErrOrder {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrOrder)
+	}
+}
+
+func TestReaderCorrupted(t *testing.T) {
+	var tree avl.Tree
+	for i := 0; i < 100; i++ {
+		tree, _ = tree.Insert(intItem(i))
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, intCodec{}, &Options{BlockSize: 16})
+	if err := w.WriteTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := buf.Bytes()
+	p[1] ^= 0xff
+
+	r, err := Open(bytes.NewReader(p), int64(len(p)), intCodec{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Search(intItem(0)); err != ErrCorrupted {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrCorrupted)
+	}
+}
+
+func writeTable(t *testing.T, tree avl.Tree, opts *Options) *Reader {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, intCodec{}, opts)
+	if err := w.WriteTree(tree); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()), intCodec{}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func mustEqual(
+	t *testing.T, name string, x int,
+	exp func(avl.Item) avl.Item,
+	act func(avl.Item) (avl.Item, error),
+) {
+	t.Helper()
+	y, err := act(intItem(x))
+	if err != nil {
+		t.Fatalf("%s(%d) error: %v", name, x, err)
+	}
+	if z := exp(intItem(x)); y != z {
+		t.Errorf("unexpected %s(%d): %v; want %v", name, x, y, z)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type intItem int
+
+func (a intItem) Compare(b avl.Item) int {
+	return int(a) - int(b.(intItem))
+}
+
+type intCodec struct{}
+
+func (intCodec) EncodeItem(x avl.Item) ([]byte, error) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], int64(x.(intItem)))
+	return buf[:n], nil
+}
+
+func (intCodec) DecodeItem(p []byte) (avl.Item, error) {
+	x, n := binary.Varint(p)
+	if n <= 0 || n != len(p) {
+		return nil, errors.New("malformed int item")
+	}
+	return intItem(x), nil
+}
@@ -0,0 +1,240 @@
+/*
+Package sstable implements immutable sorted string table files built from
+avl.Tree snapshots.
+
+Table file consists of data blocks holding encoded items in order, an index
+block holding the first item of each data block, an optional Bloom filter
+block and a fixed size footer:
+
+	[data block 0] ... [data block N] [index block] [filter block] [footer]
+
+Each block is followed by its CRC-32 checksum. The footer holds locations of
+the index and filter blocks and ends with magic bytes.
+
+It is designed to let avl.Tree act as the in-memory table of a storage
+engine: a tree snapshot is flushed into a table with Writer and is read
+later with Reader.
+*/
+package sstable
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"github.com/gobwas/avl"
+)
+
+const (
+	magic      = "avlsst01"
+	footerSize = 5*8 + 2*4 + len(magic)
+
+	defaultBlockSize  = 4096
+	defaultBitsPerKey = 10
+)
+
+// ErrOrder is returned by Writer when items are added not in strictly
+// increasing order.
+var ErrOrder = errors.New("sstable: items are not in increasing order")
+
+// Options holds table parameters. Nil *Options means defaults.
+type Options struct {
+	// BlockSize is the approximate size of data blocks in bytes.
+	// If zero, the default of 4KB is used.
+	BlockSize int
+
+	// FilterKey returns bytes identifying the item for the Bloom filter.
+	// It must return the same bytes for an item stored in the table and for
+	// an item used to search for it.
+	//
+	// If FilterKey is nil, no filter is written or used.
+	FilterKey func(avl.Item) []byte
+
+	// FilterBitsPerKey is the number of filter bits per item.
+	// If zero, the default of 10 bits is used, which gives ~1% false
+	// positive rate.
+	FilterBitsPerKey int
+}
+
+func (opts *Options) blockSize() int {
+	if opts == nil || opts.BlockSize <= 0 {
+		return defaultBlockSize
+	}
+	return opts.BlockSize
+}
+
+func (opts *Options) filterKey() func(avl.Item) []byte {
+	if opts == nil {
+		return nil
+	}
+	return opts.FilterKey
+}
+
+func (opts *Options) bitsPerKey() int {
+	if opts == nil || opts.FilterBitsPerKey <= 0 {
+		return defaultBitsPerKey
+	}
+	return opts.FilterBitsPerKey
+}
+
+// Writer writes a table. Items must be added in strictly increasing order,
+// which is the case when table is built from an avl.Tree with WriteTree().
+type Writer struct {
+	w     *bufio.Writer
+	pos   int64
+	codec avl.ItemCodec
+	opts  *Options
+	count int
+	last  avl.Item
+	err   error
+
+	block  []byte
+	first  []byte
+	index  []byte
+	blocks int
+	hashes []uint64
+}
+
+// NewWriter creates a new Writer writing table to w.
+// Items are encoded with given codec.
+func NewWriter(w io.Writer, codec avl.ItemCodec, opts *Options) *Writer {
+	return &Writer{
+		w:     bufio.NewWriter(w),
+		codec: codec,
+		opts:  opts,
+	}
+}
+
+// WriteTree adds all items of t to the table.
+func (w *Writer) WriteTree(t avl.Tree) error {
+	t.InOrder(func(x avl.Item) bool {
+		return w.Add(x) == nil
+	})
+	return w.err
+}
+
+// Add adds item x to the table. It must be greater than any previously added
+// item.
+func (w *Writer) Add(x avl.Item) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.last != nil && x.Compare(w.last) <= 0 {
+		w.err = ErrOrder
+		return w.err
+	}
+	p, err := w.codec.EncodeItem(x)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	if len(w.block) == 0 {
+		w.first = append(w.first[:0], p...)
+	}
+	w.block = appendBytes(w.block, p)
+	if key := w.opts.filterKey(); key != nil {
+		w.hashes = append(w.hashes, hash(key(x)))
+	}
+	w.last = x
+	w.count++
+
+	if len(w.block) >= w.opts.blockSize() {
+		w.err = w.flushBlock()
+	}
+	return w.err
+}
+
+// Close writes the rest of the table. It does not close the underlying
+// writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.flushBlock(); err != nil {
+		return w.fail(err)
+	}
+	index := make([]byte, 0, binary.MaxVarintLen64+len(w.index))
+	index = appendUvarint(index, uint64(w.blocks))
+	index = append(index, w.index...)
+	indexOff, indexLen, indexSum, err := w.writeBlock(index)
+	if err != nil {
+		return w.fail(err)
+	}
+	var filterOff, filterLen int64
+	var filterSum uint32
+	if w.opts.filterKey() != nil {
+		filter := buildFilter(w.hashes, w.opts.bitsPerKey())
+		filterOff, filterLen, filterSum, err = w.writeBlock(filter)
+		if err != nil {
+			return w.fail(err)
+		}
+	}
+	var footer [footerSize]byte
+	binary.LittleEndian.PutUint64(footer[0:], uint64(indexOff))
+	binary.LittleEndian.PutUint64(footer[8:], uint64(indexLen))
+	binary.LittleEndian.PutUint64(footer[16:], uint64(filterOff))
+	binary.LittleEndian.PutUint64(footer[24:], uint64(filterLen))
+	binary.LittleEndian.PutUint64(footer[32:], uint64(w.count))
+	binary.LittleEndian.PutUint32(footer[40:], indexSum)
+	binary.LittleEndian.PutUint32(footer[44:], filterSum)
+	copy(footer[48:], magic)
+	if _, err := w.w.Write(footer[:]); err != nil {
+		return w.fail(err)
+	}
+	if err := w.w.Flush(); err != nil {
+		return w.fail(err)
+	}
+	w.err = errors.New("sstable: writer is closed")
+	return nil
+}
+
+func (w *Writer) fail(err error) error {
+	w.err = err
+	return err
+}
+
+func (w *Writer) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	off, size, _, err := w.writeBlock(w.block)
+	if err != nil {
+		return err
+	}
+	w.index = appendBytes(w.index, w.first)
+	w.index = appendUvarint(w.index, uint64(off))
+	w.index = appendUvarint(w.index, uint64(size))
+	w.blocks++
+	w.block = w.block[:0]
+	return nil
+}
+
+// writeBlock writes p followed by its checksum. It returns offset and size of
+// the written block (including the checksum) and the checksum itself.
+func (w *Writer) writeBlock(p []byte) (off, size int64, sum uint32, err error) {
+	var buf [4]byte
+	sum = crc32.ChecksumIEEE(p)
+	binary.LittleEndian.PutUint32(buf[:], sum)
+	if _, err = w.w.Write(p); err != nil {
+		return 0, 0, 0, err
+	}
+	if _, err = w.w.Write(buf[:]); err != nil {
+		return 0, 0, 0, err
+	}
+	off, size = w.pos, int64(len(p)+len(buf))
+	w.pos += size
+	return off, size, sum, nil
+}
+
+func appendUvarint(p []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	return append(p, buf[:n]...)
+}
+
+func appendBytes(p, b []byte) []byte {
+	p = appendUvarint(p, uint64(len(b)))
+	return append(p, b...)
+}
@@ -0,0 +1,628 @@
+package avl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// storeMagic is written at the very beginning of a store file. Besides
+// identifying the file it guarantees that no record starts at zero offset,
+// which is used to encode nil node references.
+const storeMagic = "avlstor1"
+
+const (
+	recordNode byte = 1
+	recordRoot byte = 2
+)
+
+// maxRecordSize limits the size of a single record payload to protect from
+// huge allocations when reading corrupted files.
+const maxRecordSize = 1 << 30
+
+var (
+	// ErrNoVersion is returned by Store when requested version of a tree is
+	// not present in the store.
+	ErrNoVersion = errors.New("avl: no such version")
+
+	// ErrStoreClosed is returned by Store methods called after Close().
+	ErrStoreClosed = errors.New("avl: store is closed")
+
+	errCorruptedRecord = errors.New("avl: corrupted record")
+)
+
+// Store is an append-only file holding nodes of one or more versions of a
+// tree.
+//
+// Each node is written to the file only once and is referenced by its offset
+// afterwards. Since modifying operations on a Tree copy only the O(log n)
+// nodes on the path to the affected node, committing a new version of a tree
+// appends only those copied nodes plus a small root record.
+//
+// Store keeps track of the nodes of the latest committed version only. That
+// is, committing a tree derived from the latest version (either committed or
+// loaded) writes only the copied nodes, while committing a tree derived from
+// some older version writes all nodes of the tree again.
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	codec   ItemCodec
+	end     int64
+	roots   []storeRoot
+	root    *node // Root of the latest version if its nodes are tracked.
+	offsets map[*node]int64
+	nodes   map[int64]*node
+}
+
+type storeRoot struct {
+	version uint64
+	offset  int64
+	size    int
+}
+
+// OpenStore opens a store file at given path, creating it if necessary.
+// Items are encoded and decoded with given codec.
+//
+// If the file has an incomplete tail left after a crash during Commit(), the
+// tail is truncated up to the last committed version. A damaged record
+// followed by valid ones is reported as an error and the file is left as is.
+func OpenStore(path string, codec ItemCodec) (*Store, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		path:  path,
+		file:  file,
+		codec: codec,
+	}
+	s.reset()
+	if err := s.init(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) reset() {
+	s.roots = nil
+	s.root = nil
+	s.offsets = make(map[*node]int64)
+	s.nodes = make(map[int64]*node)
+}
+
+func (s *Store) init() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := s.file.WriteAt([]byte(storeMagic), 0); err != nil {
+			return err
+		}
+		s.end = int64(len(storeMagic))
+		return s.file.Sync()
+	}
+	r := bufio.NewReader(io.NewSectionReader(s.file, 0, info.Size()))
+	magic := make([]byte, len(storeMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != storeMagic {
+		return fmt.Errorf("avl: %s is not a store file", s.path)
+	}
+	var (
+		pos = int64(len(storeMagic))
+		end = pos
+	)
+	for {
+		kind, payload, n, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if tornRecord(err, s.file, pos, info.Size()) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("avl: read %s at offset %d: %w", s.path, pos, err)
+		}
+		pos += n
+		if kind != recordRoot {
+			continue
+		}
+		root, err := decodeStoreRoot(payload)
+		if err != nil {
+			return fmt.Errorf("avl: read %s at offset %d: %w", s.path, pos-n, err)
+		}
+		s.roots = append(s.roots, root)
+		end = pos
+	}
+	if end < info.Size() {
+		// Drop nodes which were written without being committed.
+		if err := s.file.Truncate(end); err != nil {
+			return err
+		}
+	}
+	s.end = end
+	return nil
+}
+
+// Commit writes nodes of t which are not yet present in the store and
+// appends a root record referencing t's root. It returns version number of
+// the committed tree which can be used to Load() it later.
+func (s *Store) Commit(t Tree) (version uint64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return 0, ErrStoreClosed
+	}
+	if _, err := s.file.Seek(s.end, io.SeekStart); err != nil {
+		return 0, err
+	}
+	version = 1
+	if n := len(s.roots); n > 0 {
+		version = s.roots[n-1].version + 1
+	}
+	nw := &nodeWriter{
+		w:       bufio.NewWriter(s.file),
+		pos:     s.end,
+		codec:   s.codec,
+		known:   s.offsets,
+		written: make(map[*node]int64),
+	}
+	root, err := nw.commit(t, version)
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		// Leave the file in the state of the last successful commit.
+		s.file.Truncate(s.end)
+		return 0, err
+	}
+	// Forget the nodes of the previous version which are not shared with
+	// the committed one. Such nodes are reachable only through the nodes
+	// which were just written.
+	shared := make(map[*node]bool)
+	if _, ok := s.offsets[t.root]; ok {
+		shared[t.root] = true
+	}
+	for n := range nw.written {
+		for _, c := range [2]*node{n.left, n.right} {
+			if _, ok := s.offsets[c]; ok {
+				shared[c] = true
+			}
+		}
+	}
+	s.forget(s.root, shared)
+	for n, off := range nw.written {
+		s.offsets[n] = off
+		s.nodes[off] = n
+	}
+	s.root = t.root
+	s.roots = append(s.roots, root)
+	s.end = nw.pos
+
+	return version, nil
+}
+
+// Versions returns sorted list of committed versions present in the store.
+func (s *Store) Versions() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vs := make([]uint64, len(s.roots))
+	for i, r := range s.roots {
+		vs[i] = r.version
+	}
+	return vs
+}
+
+// Load loads a tree of given version from the store.
+// Nodes shared with the latest version are loaded only once.
+func (s *Store) Load(version uint64) (Tree, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return Tree{}, ErrStoreClosed
+	}
+	i := sort.Search(len(s.roots), func(i int) bool {
+		return s.roots[i].version >= version
+	})
+	if i == len(s.roots) || s.roots[i].version != version {
+		return Tree{}, ErrNoVersion
+	}
+	r := s.roots[i]
+	loaded := make(map[int64]*node)
+	root, err := s.load(r.offset, loaded)
+	if err != nil {
+		return Tree{}, err
+	}
+	if i == len(s.roots)-1 && s.root == nil {
+		s.track(root, loaded)
+	}
+	return Tree{
+		root: root,
+		size: r.size,
+	}, nil
+}
+
+// Compact rewrites the store file such that it holds only the versions for
+// which keep returns true and the nodes reachable from their roots. Nil keep
+// retains all committed versions, dropping only unreachable nodes. The latest
+// version is always retained, thus versions committed after compaction
+// continue the sequence.
+//
+// Retained versions keep their numbers and share nodes the same way as before
+// compaction. If the store file can not be reopened after it is replaced, the
+// store becomes closed.
+func (s *Store) Compact(keep func(version uint64) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return ErrStoreClosed
+	}
+	if len(s.roots) == 0 {
+		return nil
+	}
+	var (
+		roots  []storeRoot
+		trees  []Tree
+		loaded = make(map[int64]*node)
+	)
+	for i, r := range s.roots {
+		if keep != nil && i != len(s.roots)-1 && !keep(r.version) {
+			continue
+		}
+		root, err := s.load(r.offset, loaded)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, r)
+		trees = append(trees, Tree{root: root, size: r.size})
+	}
+	tmp := s.path + ".compact"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	nw := &nodeWriter{
+		w:       bufio.NewWriter(file),
+		codec:   s.codec,
+		written: make(map[*node]int64),
+	}
+	_, err = nw.w.WriteString(storeMagic)
+	nw.pos = int64(len(storeMagic))
+	for i := 0; err == nil && i < len(trees); i++ {
+		roots[i], err = nw.commit(trees[i], roots[i].version)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Note that we close the file before renaming since some platforms do
+	// not allow to replace opened files.
+	s.file.Close()
+	s.file = nil
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	file, oerr := os.OpenFile(s.path, os.O_RDWR, 0644)
+	if oerr != nil {
+		// It is not known which file the state describes anymore, so make
+		// the store closed.
+		s.reset()
+		if err == nil {
+			err = oerr
+		}
+		return err
+	}
+	s.file = file
+	if err != nil {
+		// The old file is still in use.
+		return err
+	}
+	s.reset()
+	written := make(map[int64]*node, len(nw.written))
+	for n, off := range nw.written {
+		written[off] = n
+	}
+	s.track(trees[len(trees)-1].root, written)
+	s.roots = roots
+	s.end = nw.pos
+
+	return nil
+}
+
+// Close closes the store file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return ErrStoreClosed
+	}
+	err := s.file.Close()
+	s.file = nil
+	s.reset()
+	return err
+}
+
+// load loads a node at given offset and its subtrees. Nodes which are not
+// tracked by the store are looked up and saved in loaded.
+func (s *Store) load(off int64, loaded map[int64]*node) (*node, error) {
+	if off == 0 {
+		return nil, nil
+	}
+	if n, ok := s.nodes[off]; ok {
+		return n, nil
+	}
+	if n, ok := loaded[off]; ok {
+		return n, nil
+	}
+	r := bufio.NewReader(io.NewSectionReader(s.file, off, s.end-off))
+	kind, p, _, err := readRecord(r)
+	if err != nil {
+		return nil, fmt.Errorf("avl: read node at %d: %w", off, err)
+	}
+	if kind != recordNode {
+		return nil, fmt.Errorf("avl: read node at %d: %w", off, errCorruptedRecord)
+	}
+	var refs [3]uint64
+	for i := range refs {
+		v, n := binary.Uvarint(p)
+		if n <= 0 {
+			return nil, fmt.Errorf("avl: read node at %d: %w", off, errCorruptedRecord)
+		}
+		refs[i], p = v, p[n:]
+	}
+	value, err := s.codec.DecodeItem(p)
+	if err != nil {
+		return nil, fmt.Errorf("avl: decode item at %d: %w", off, err)
+	}
+	left, err := s.load(int64(refs[0]), loaded)
+	if err != nil {
+		return nil, err
+	}
+	right, err := s.load(int64(refs[1]), loaded)
+	if err != nil {
+		return nil, err
+	}
+	n := &node{
+		value: value,
+		left:  left,
+		right: right,
+		h:     int16(refs[2]),
+	}
+	loaded[off] = n
+
+	return n, nil
+}
+
+// track makes the tree with given root the latest version tracked by the
+// store. Offsets of nodes which are not tracked yet are taken from nodes.
+func (s *Store) track(root *node, nodes map[int64]*node) {
+	offsets := make(map[*node]int64, len(nodes))
+	for off, n := range nodes {
+		offsets[n] = off
+	}
+	var walk func(*node)
+	walk = func(n *node) {
+		if n == nil {
+			return
+		}
+		if _, ok := s.offsets[n]; ok {
+			return
+		}
+		off := offsets[n]
+		s.offsets[n] = off
+		s.nodes[off] = n
+		walk(n.left)
+		walk(n.right)
+	}
+	walk(root)
+	s.root = root
+}
+
+// forget stops tracking nodes of the tree with given root except the
+// subtrees rooted at shared nodes.
+func (s *Store) forget(n *node, shared map[*node]bool) {
+	if n == nil || shared[n] {
+		return
+	}
+	if off, ok := s.offsets[n]; ok {
+		delete(s.offsets, n)
+		delete(s.nodes, off)
+	}
+	s.forget(n.left, shared)
+	s.forget(n.right, shared)
+}
+
+// nodeWriter writes nodes which are not known yet in post-order, such that
+// children are always written before their parents.
+type nodeWriter struct {
+	w       *bufio.Writer
+	pos     int64
+	codec   ItemCodec
+	known   map[*node]int64
+	written map[*node]int64
+}
+
+func (nw *nodeWriter) commit(t Tree, version uint64) (storeRoot, error) {
+	off, err := nw.write(t.root)
+	if err != nil {
+		return storeRoot{}, err
+	}
+	p := make([]byte, 0, binary.MaxVarintLen64*3)
+	p = appendUvarint(p, version)
+	p = appendUvarint(p, uint64(off))
+	p = appendUvarint(p, uint64(t.size))
+	if _, err := nw.writeRecord(recordRoot, p); err != nil {
+		return storeRoot{}, err
+	}
+	if err := nw.w.Flush(); err != nil {
+		return storeRoot{}, err
+	}
+	return storeRoot{
+		version: version,
+		offset:  off,
+		size:    t.size,
+	}, nil
+}
+
+func (nw *nodeWriter) write(n *node) (int64, error) {
+	if n == nil {
+		return 0, nil
+	}
+	if off, ok := nw.known[n]; ok {
+		return off, nil
+	}
+	if off, ok := nw.written[n]; ok {
+		return off, nil
+	}
+	left, err := nw.write(n.left)
+	if err != nil {
+		return 0, err
+	}
+	right, err := nw.write(n.right)
+	if err != nil {
+		return 0, err
+	}
+	item, err := nw.codec.EncodeItem(n.value)
+	if err != nil {
+		return 0, err
+	}
+	p := make([]byte, 0, binary.MaxVarintLen64*3+len(item))
+	p = appendUvarint(p, uint64(left))
+	p = appendUvarint(p, uint64(right))
+	p = appendUvarint(p, uint64(n.h))
+	p = append(p, item...)
+
+	off, err := nw.writeRecord(recordNode, p)
+	if err != nil {
+		return 0, err
+	}
+	nw.written[n] = off
+
+	return off, nil
+}
+
+func (nw *nodeWriter) writeRecord(kind byte, payload []byte) (int64, error) {
+	off := nw.pos
+	n, err := writeRecord(nw.w, kind, payload)
+	nw.pos += int64(n)
+	return off, err
+}
+
+func decodeStoreRoot(p []byte) (r storeRoot, err error) {
+	var vs [3]uint64
+	for i := range vs {
+		v, n := binary.Uvarint(p)
+		if n <= 0 {
+			return r, errCorruptedRecord
+		}
+		vs[i], p = v, p[n:]
+	}
+	return storeRoot{
+		version: vs[0],
+		offset:  int64(vs[1]),
+		size:    int(vs[2]),
+	}, nil
+}
+
+// writeRecord writes a record of given kind and payload to w.
+// Record consists of the kind byte, uvarint-encoded payload length, payload
+// itself and CRC-32 checksum of all the preceding bytes.
+func writeRecord(w io.Writer, kind byte, payload []byte) (int, error) {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64+len(payload)+4)
+	buf = append(buf, kind)
+	buf = appendUvarint(buf, uint64(len(payload)))
+	buf = append(buf, payload...)
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf))
+	buf = append(buf, sum[:]...)
+	return w.Write(buf)
+}
+
+// readRecord reads a record written by writeRecord(). It returns record's
+// kind, payload and total number of bytes read.
+func readRecord(r *bufio.Reader) (kind byte, payload []byte, n int64, err error) {
+	kind, err = r.ReadByte()
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, 0, unexpectedEOF(err)
+	}
+	if size > maxRecordSize {
+		return 0, nil, 0, errCorruptedRecord
+	}
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64+int(size)+4)
+	buf = append(buf, kind)
+	buf = appendUvarint(buf, size)
+	head := len(buf)
+	buf = buf[:head+int(size)+4]
+	if _, err := io.ReadFull(r, buf[head:]); err != nil {
+		return 0, nil, 0, unexpectedEOF(err)
+	}
+	tail := len(buf) - 4
+	if crc32.ChecksumIEEE(buf[:tail]) != binary.LittleEndian.Uint32(buf[tail:]) {
+		return 0, nil, 0, errCorruptedRecord
+	}
+	return kind, buf[head:tail], int64(len(buf)), nil
+}
+
+// tornRecord reports whether err returned by readRecord() for a record at
+// offset off of a file of given size means that the record was torn by a
+// crash in the middle of write. Such record is always the last one, thus a
+// damaged record followed by a valid one means that the file is corrupted.
+func tornRecord(err error, r io.ReaderAt, off, size int64) bool {
+	if err != io.ErrUnexpectedEOF && err != errCorruptedRecord {
+		return false
+	}
+	var head [1 + binary.MaxVarintLen64]byte
+	for pos := off + 1; pos < size; pos++ {
+		// Look at the header first to not read records which can't fit
+		// the rest of the file.
+		n, _ := r.ReadAt(head[:], pos)
+		if n < 2 {
+			continue
+		}
+		x, m := binary.Uvarint(head[1:n])
+		if m <= 0 || x > maxRecordSize || pos+int64(1+m)+int64(x)+4 > size {
+			continue
+		}
+		br := bufio.NewReader(io.NewSectionReader(r, pos, size-pos))
+		if _, _, _, err := readRecord(br); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func appendUvarint(p []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	return append(p, buf[:n]...)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
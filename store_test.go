@@ -0,0 +1,303 @@
+package avl
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreCommitLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	s, err := OpenStore(path, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		tree Tree
+		exp  [][]int
+		size []int64
+	)
+	for i := 0; i < 64; i++ {
+		tree, _ = tree.Insert(IntItem(i))
+		if _, err := s.Commit(tree); err != nil {
+			t.Fatal(err)
+		}
+		size = append(size, fileSize(t, path))
+		exp = append(exp, makeRange(0, i+1))
+	}
+	// Last commits must append only the copied path.
+	if d := size[63] - size[62]; d > 256 {
+		t.Errorf("unexpected size of the commit: %d bytes", d)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenStore(path, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	vs := s.Versions()
+	if act, exp := len(vs), len(exp); act != exp {
+		t.Fatalf("unexpected number of versions: %d; want %d", act, exp)
+	}
+	for i, v := range vs {
+		tree, err := s.Load(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if act, exp := tree.Size(), len(exp[i]); act != exp {
+			t.Errorf("unexpected size of version %d: %d; want %d", v, act, exp)
+		}
+		assertInOrder(t, tree.root, exp[i])
+	}
+	if _, err := s.Load(100); err != ErrNoVersion {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrNoVersion)
+	}
+}
+
+func TestStoreTrackedNodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	s, err := OpenStore(path, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		s.Close()
+	}()
+
+	assertTracked := func(tree Tree) {
+		t.Helper()
+		if n := len(s.offsets); n != tree.Size() || len(s.nodes) != n {
+			t.Fatalf(
+				"unexpected number of tracked nodes: %d (%d); want %d",
+				n, len(s.nodes), tree.Size(),
+			)
+		}
+	}
+	var tree Tree
+	for i := 0; i < 64; i++ {
+		tree, _ = tree.Insert(IntItem(i))
+		if i%3 == 0 {
+			tree, _ = tree.Delete(IntItem(i / 2))
+		}
+		if _, err := s.Commit(tree); err != nil {
+			t.Fatal(err)
+		}
+		assertTracked(tree)
+	}
+	// Loading older versions must not make the store to track their nodes.
+	if _, err := s.Load(10); err != nil {
+		t.Fatal(err)
+	}
+	assertTracked(tree)
+
+	// After reopen the latest version is tracked once loaded, such that
+	// committing a tree derived from it writes only the copied path.
+	s.Close()
+	if s, err = OpenStore(path, intCodec{}); err != nil {
+		t.Fatal(err)
+	}
+	vs := s.Versions()
+	if tree, err = s.Load(vs[len(vs)-1]); err != nil {
+		t.Fatal(err)
+	}
+	assertTracked(tree)
+	before := fileSize(t, path)
+	tree, _ = tree.Insert(IntItem(100))
+	if _, err := s.Commit(tree); err != nil {
+		t.Fatal(err)
+	}
+	if d := fileSize(t, path) - before; d > 256 {
+		t.Errorf("unexpected size of the commit: %d bytes", d)
+	}
+	assertTracked(tree)
+
+	if err := s.Compact(nil); err != nil {
+		t.Fatal(err)
+	}
+	assertTracked(tree)
+}
+
+func TestStoreTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	s, err := OpenStore(path, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := buildTreeFrom(1, 2, 3)
+	if _, err := s.Commit(tree); err != nil {
+		t.Fatal(err)
+	}
+	tree, _ = tree.Insert(IntItem(4))
+	if _, err := s.Commit(tree); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Cut the last root record.
+	size := fileSize(t, path)
+	if err := os.Truncate(path, size-2); err != nil {
+		t.Fatal(err)
+	}
+	s, err = OpenStore(path, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	vs := s.Versions()
+	if len(vs) != 1 {
+		t.Fatalf("unexpected versions: %v", vs)
+	}
+	tree, err = s.Load(vs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInOrder(t, tree.root, []int{1, 2, 3})
+
+	tree, _ = tree.Insert(IntItem(5))
+	v, err := s.Commit(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 2 {
+		t.Fatalf("unexpected version: %d", v)
+	}
+}
+
+func TestStoreCorruptedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	s, err := OpenStore(path, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tree Tree
+	for i := 0; i < 10; i++ {
+		tree, _ = tree.Insert(IntItem(i))
+		if _, err := s.Commit(tree); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, off := range []int{
+		len(storeMagic),     // Kind of the first record.
+		len(storeMagic) + 1, // Size of the first record.
+		20,
+	} {
+		damaged := append([]byte(nil), data...)
+		damaged[off] ^= 0x7f
+		if err := ioutil.WriteFile(path, damaged, 0644); err != nil {
+			t.Fatal(err)
+		}
+		s, err := OpenStore(path, intCodec{})
+		if err == nil {
+			s.Close()
+			t.Fatalf("expected error for corrupted byte at %d", off)
+		}
+		if size := fileSize(t, path); size != int64(len(data)) {
+			t.Fatalf("file is truncated to %d bytes", size)
+		}
+	}
+}
+
+func TestStoreCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree")
+	s, err := OpenStore(path, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var tree Tree
+	for i := 0; i < 32; i++ {
+		tree, _ = tree.Insert(IntItem(i))
+		if _, err := s.Commit(tree); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// All versions are reachable, thus nothing must be dropped.
+	before := fileSize(t, path)
+	if err := s.Compact(nil); err != nil {
+		t.Fatal(err)
+	}
+	if after := fileSize(t, path); after != before {
+		t.Fatalf("unexpected file size after compaction: %d; before %d", after, before)
+	}
+	for v := uint64(1); v <= 32; v++ {
+		loaded, err := s.Load(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertInOrder(t, loaded.root, makeRange(0, int(v)))
+	}
+
+	if err := s.Compact(func(v uint64) bool {
+		return v == 16
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if after := fileSize(t, path); after >= before {
+		t.Fatalf("unexpected file size after compaction: %d; before %d", after, before)
+	}
+	vs := s.Versions()
+	if len(vs) != 2 || vs[0] != 16 || vs[1] != 32 {
+		t.Fatalf("unexpected versions: %v", vs)
+	}
+	if _, err := s.Load(1); err != ErrNoVersion {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrNoVersion)
+	}
+	loaded, err := s.Load(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertInOrder(t, loaded.root, makeRange(0, 16))
+
+	// Nodes of the current tree must still be known by the store.
+	before = fileSize(t, path)
+	tree, _ = tree.Insert(IntItem(100))
+	if _, err := s.Commit(tree); err != nil {
+		t.Fatal(err)
+	}
+	if d := fileSize(t, path) - before; d > 256 {
+		t.Errorf("unexpected size of the commit: %d bytes", d)
+	}
+	if loaded, err = s.Load(33); err != nil {
+		t.Fatal(err)
+	}
+	assertInOrder(t, loaded.root, append(makeRange(0, 32), 100))
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+type intCodec struct{}
+
+func (intCodec) EncodeItem(x Item) ([]byte, error) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], int64(x.(IntItem)))
+	return buf[:n], nil
+}
+
+func (intCodec) DecodeItem(p []byte) (Item, error) {
+	x, n := binary.Varint(p)
+	if n <= 0 || n != len(p) {
+		return nil, errors.New("malformed int item")
+	}
+	return IntItem(x), nil
+}
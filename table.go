@@ -0,0 +1,246 @@
+package avl
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrConflict is returned when an operation would break the uniqueness of
+// items.
+var ErrConflict = errors.New("avl: conflict")
+
+// IndexSpec describes a secondary index of a Table.
+type IndexSpec struct {
+	// Name is the name of the index used by Table.Index().
+	Name string
+
+	// Key returns the index key of a record. Keys are ordered by their
+	// Compare() method. Records with nil key are not indexed.
+	Key func(Item) Item
+
+	// Unique makes Table to reject records having the same key as some other
+	// record with ErrConflict.
+	Unique bool
+}
+
+// Table is an immutable container of records ordered by their Compare()
+// method (the primary order) and by any number of secondary indexes.
+//
+// Modifying operations (Insert(), Update() and Delete()) update the primary
+// tree and all index trees at once, returning a copy of the table. That is,
+// indexes of any Table value are always consistent with its records.
+//
+// Like Tree, Table is a reference type. The zero value is an empty table
+// without indexes.
+type Table struct {
+	schema  *schema
+	primary Tree
+	indexes []Tree
+}
+
+type schema struct {
+	specs []IndexSpec
+	names map[string]int
+}
+
+// NewTable creates an empty table with given secondary indexes.
+// It panics if index names are not unique or Key is nil.
+func NewTable(specs ...IndexSpec) Table {
+	s := &schema{
+		specs: append([]IndexSpec(nil), specs...),
+		names: make(map[string]int, len(specs)),
+	}
+	for i, spec := range specs {
+		if spec.Key == nil {
+			panic(fmt.Sprintf("avl: index %q has nil Key", spec.Name))
+		}
+		if _, has := s.names[spec.Name]; has {
+			panic(fmt.Sprintf("avl: duplicate index %q", spec.Name))
+		}
+		s.names[spec.Name] = i
+	}
+	return Table{
+		schema:  s,
+		indexes: make([]Tree, len(specs)),
+	}
+}
+
+// Size returns the number of records in the table.
+// The time complexity is O(1).
+func (t Table) Size() int {
+	return t.primary.Size()
+}
+
+// Tree returns the tree of records in the primary order.
+func (t Table) Tree() Tree {
+	return t.primary
+}
+
+// Search searches for a record equal to x in terms of the primary order.
+func (t Table) Search(x Item) Item {
+	return t.primary.Search(x)
+}
+
+// Insert inserts record x in the table.
+// It returns a copy of the table and already existing record, which non-nil
+// value means that x was not inserted. It returns ErrConflict if x violates
+// some unique index.
+func (t Table) Insert(x Item) (_ Table, existing Item, err error) {
+	if existing = t.primary.Search(x); existing != nil {
+		return t, existing, nil
+	}
+	t, err = t.put(x, nil)
+	return t, nil, err
+}
+
+// Update replaces the record equal to x in terms of the primary order or
+// inserts x if there is no such record. It returns a copy of the table and the
+// replaced record. It returns ErrConflict if x violates some unique index; in
+// that case the table is left unchanged. The table is also left unchanged if
+// x is equal to the replaced record (see Equaler).
+func (t Table) Update(x Item) (_ Table, prev Item, err error) {
+	prev = t.primary.Search(x)
+	if prev != nil && equalItems(x, prev) {
+		return t, prev, nil
+	}
+	t, err = t.put(x, prev)
+	if err != nil {
+		return t, nil, err
+	}
+	return t, prev, nil
+}
+
+// Delete deletes the record equal to x in terms of the primary order.
+// It returns a copy of the table and the deleted record if it was present.
+func (t Table) Delete(x Item) (_ Table, existed Item) {
+	t.primary, existed = t.primary.Delete(x)
+	if existed == nil {
+		return t, nil
+	}
+	t.indexes = append([]Tree(nil), t.indexes...)
+	for i, spec := range t.specs() {
+		if k := spec.Key(existed); k != nil {
+			t.indexes[i], _ = t.indexes[i].Delete(indexEntry{k, existed})
+		}
+	}
+	return t, existed
+}
+
+// put puts record x replacing record prev in the primary tree and indexes.
+// On error it returns t unchanged.
+func (t Table) put(x, prev Item) (Table, error) {
+	var (
+		specs   = t.specs()
+		indexes = make([]Tree, len(specs))
+	)
+	copy(indexes, t.indexes)
+	for i, spec := range specs {
+		idx := indexes[i]
+		if prev != nil {
+			if k := spec.Key(prev); k != nil {
+				idx, _ = idx.Delete(indexEntry{k, prev})
+			}
+		}
+		k := spec.Key(x)
+		if k == nil {
+			indexes[i] = idx
+			continue
+		}
+		if spec.Unique && idx.Search(indexProbe{k, 0}) != nil {
+			return t, ErrConflict
+		}
+		indexes[i], _ = idx.Insert(indexEntry{k, x})
+	}
+	t.primary, _ = t.primary.Update(x)
+	t.indexes = indexes
+	return t, nil
+}
+
+func (t Table) specs() []IndexSpec {
+	if t.schema == nil {
+		return nil
+	}
+	return t.schema.specs
+}
+
+// Index returns the index with given name.
+// It panics if there is no such index.
+func (t Table) Index(name string) Index {
+	i, has := -1, false
+	if t.schema != nil {
+		i, has = t.schema.names[name]
+	}
+	if !has {
+		panic(fmt.Sprintf("avl: no index %q", name))
+	}
+	return Index{
+		tree: t.indexes[i],
+	}
+}
+
+// Index is an immutable view of a Table's secondary index.
+// Records having equal keys are ordered by the primary order.
+type Index struct {
+	tree Tree
+}
+
+// Size returns the number of indexed records.
+// The time complexity is O(1).
+func (x Index) Size() int {
+	return x.tree.Size()
+}
+
+// Search returns the first record having given key or nil.
+// The time complexity is O(log n).
+func (x Index) Search(key Item) Item {
+	e := x.tree.Successor(indexProbe{key, -1})
+	if e == nil || key.Compare(e.(indexEntry).key) != 0 {
+		return nil
+	}
+	return e.(indexEntry).record
+}
+
+// Range calls fn for each record having key greater than or equal to lo and
+// less than hi in the index order. Nil lo or hi means no lower or upper
+// bound respectively. If fn returns false Range stops.
+func (x Index) Range(lo, hi Item, fn func(Item) bool) {
+	var a, b Item
+	if lo != nil {
+		a = indexProbe{lo, -1}
+	}
+	if hi != nil {
+		b = indexProbe{hi, -1}
+	}
+	x.tree.root.ascend(a, b, func(e Item) bool {
+		return fn(e.(indexEntry).record)
+	})
+}
+
+// indexEntry is an item of index tree.
+type indexEntry struct {
+	key    Item
+	record Item
+}
+
+func (e indexEntry) Compare(x Item) int {
+	y := x.(indexEntry)
+	if cmp := e.key.Compare(y.key); cmp != 0 {
+		return cmp
+	}
+	return e.record.Compare(y.record)
+}
+
+// indexProbe is used to search index tree by key only. It compares equal to
+// entries having the same key if bias is zero; otherwise it compares less
+// (negative bias) or greater (positive bias) than such entries.
+type indexProbe struct {
+	key  Item
+	bias int
+}
+
+func (p indexProbe) Compare(x Item) int {
+	if cmp := p.key.Compare(x.(indexEntry).key); cmp != 0 {
+		return cmp
+	}
+	return p.bias
+}
@@ -0,0 +1,100 @@
+package avl
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	tbl := NewTable(
+		IndexSpec{
+			Name:   "email",
+			Key:    func(x Item) Item { return x.(record).email },
+			Unique: true,
+		},
+		IndexSpec{
+			Name: "created",
+			Key:  func(x Item) Item { return IntItem(x.(record).created) },
+		},
+	)
+	var err error
+	for _, r := range []record{
+		{id: 1, email: "b", created: 20},
+		{id: 2, email: "a", created: 10},
+		{id: 3, email: "c", created: 20},
+		{id: 4, email: "d", created: 30},
+	} {
+		if tbl, _, err = tbl.Insert(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev := tbl
+
+	_, _, err = tbl.Insert(record{id: 5, email: "a"})
+	if err != ErrConflict {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrConflict)
+	}
+	_, _, err = tbl.Update(record{id: 1, email: "c"})
+	if err != ErrConflict {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrConflict)
+	}
+	// Updating the record with its own key is not a conflict.
+	tbl, old, err := tbl.Update(record{id: 1, email: "b", created: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.(record).created != 20 {
+		t.Fatalf("unexpected previous record: %v", old)
+	}
+	tbl, _ = tbl.Delete(record{id: 4})
+
+	assertIndex(t, tbl.Index("email"), nil, nil, "1 2 3", "2 1 3")
+	assertIndex(t, tbl.Index("created"), IntItem(20), nil, "1 2 3", "3 1")
+	assertIndex(t, tbl.Index("created"), IntItem(10), IntItem(40), "1 2 3", "2 3")
+
+	// Previous snapshot must not be affected.
+	assertIndex(t, prev.Index("email"), nil, nil, "1 2 3 4", "2 1 3 4")
+	assertIndex(t, prev.Index("created"), nil, nil, "1 2 3 4", "2 1 3 4")
+
+	if r := tbl.Index("email").Search(strItem("c")); r == nil || r.(record).id != 3 {
+		t.Fatalf("unexpected search result: %v", r)
+	}
+	if r := tbl.Index("email").Search(strItem("d")); r != nil {
+		t.Fatalf("unexpected search result: %v", r)
+	}
+	if r := prev.Index("created").Search(IntItem(20)); r == nil || r.(record).id != 1 {
+		t.Fatalf("unexpected search result: %v", r)
+	}
+}
+
+func assertIndex(t *testing.T, idx Index, lo, hi Item, all, exp string) {
+	t.Helper()
+	if n := len(strings.Fields(all)); idx.Size() != n {
+		t.Errorf("unexpected index size: %d; want %d", idx.Size(), n)
+	}
+	var act []string
+	idx.Range(lo, hi, func(x Item) bool {
+		act = append(act, fmt.Sprint(x.(record).id))
+		return true
+	})
+	if s := strings.Join(act, " "); s != exp {
+		t.Errorf("unexpected range [%v, %v): %q; want %q", lo, hi, s, exp)
+	}
+}
+
+type record struct {
+	id      int
+	email   strItem
+	created int
+}
+
+func (r record) Compare(x Item) int {
+	return r.id - x.(record).id
+}
+
+type strItem string
+
+func (s strItem) Compare(x Item) int {
+	return strings.Compare(string(s), string(x.(strItem)))
+}
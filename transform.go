@@ -0,0 +1,123 @@
+package avl
+
+// Filter returns a tree holding values for which pred returns true.
+//
+// Subtrees where pred returns true for all values are shared with t; the rest
+// is rebuilt by joining the filtered subtrees. The time complexity is O(n).
+func (t Tree) Filter(pred func(Item) bool) Tree {
+	var removed int
+	t.root, removed = t.root.filter(pred)
+	t.size -= removed
+	t.root = t.merkle.rehash(t.root)
+	return t
+}
+
+// Partition splits the tree into trees holding values for which pred returns
+// true and false respectively.
+//
+// Like with Filter(), subtrees which entirely belong to one of the trees are
+// shared with t. The time complexity is O(n).
+func (t Tree) Partition(pred func(Item) bool) (in, out Tree) {
+	var n int
+	in.root, out.root, n = t.root.partition(pred)
+	in.size = n
+	out.size = t.size - n
+	in.merkle = t.merkle
+	out.merkle = t.merkle
+	in.root = t.merkle.rehash(in.root)
+	out.root = t.merkle.rehash(out.root)
+	return in, out
+}
+
+// MapValues returns a tree of the same shape holding values returned by fn
+// for each value of t.
+//
+// Values are not compared, thus fn must not change the order of values;
+// otherwise the returned tree becomes corrupted. The time complexity is O(n).
+func (t Tree) MapValues(fn func(Item) Item) Tree {
+	t.root = t.root.mapValues(fn)
+	t.root = t.merkle.rehash(t.root)
+	return t
+}
+
+// Fold calls fn for each value of the tree in order, passing the result of
+// the previous call (or init for the first call) as acc. It returns the
+// result of the last call or init if the tree is empty.
+func (t Tree) Fold(init interface{}, fn func(acc interface{}, x Item) interface{}) interface{} {
+	acc := init
+	t.root.InOrder(func(x Item) bool {
+		acc = fn(acc, x)
+		return true
+	})
+	return acc
+}
+
+// Reduce is like Fold(), but uses the min value of the tree as initial value
+// and calls fn for the rest of values. It returns nil if the tree is empty.
+func (t Tree) Reduce(fn func(acc, x Item) Item) Item {
+	var (
+		acc   Item
+		first = true
+	)
+	t.root.InOrder(func(x Item) bool {
+		if first {
+			acc, first = x, false
+		} else {
+			acc = fn(acc, x)
+		}
+		return true
+	})
+	return acc
+}
+
+func (n *node) filter(pred func(Item) bool) (root *node, removed int) {
+	if n == nil {
+		return nil, 0
+	}
+	l, rl := n.left.filter(pred)
+	r, rr := n.right.filter(pred)
+	removed = rl + rr
+	switch {
+	case !pred(n.value):
+		return join2(l, r), removed + 1
+	case l == n.left && r == n.right:
+		return n, removed
+	default:
+		return join(l, n.value, r), removed
+	}
+}
+
+func (n *node) partition(pred func(Item) bool) (in, out *node, size int) {
+	if n == nil {
+		return nil, nil, 0
+	}
+	li, lo, ln := n.left.partition(pred)
+	ri, ro, rn := n.right.partition(pred)
+	size = ln + rn
+	if pred(n.value) {
+		if li == n.left && ri == n.right {
+			in = n
+		} else {
+			in = join(li, n.value, ri)
+		}
+		return in, join2(lo, ro), size + 1
+	}
+	if lo == n.left && ro == n.right {
+		out = n
+	} else {
+		out = join(lo, n.value, ro)
+	}
+	return join2(li, ri), out, size
+}
+
+func (n *node) mapValues(fn func(Item) Item) *node {
+	if n == nil {
+		return nil
+	}
+	return &node{
+		value: fn(n.value),
+		left:  n.left.mapValues(fn),
+		right: n.right.mapValues(fn),
+		h:     n.h,
+	}
+}
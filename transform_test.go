@@ -0,0 +1,127 @@
+package avl
+
+import (
+	"crypto"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestFilterPartition(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for _, n := range []int{0, 1, 2, 10, 100, 1000} {
+		tree := NewMerkle(crypto.SHA256, intCodec{})
+		for _, x := range rnd.Perm(n) {
+			tree, _ = tree.Insert(IntItem(x))
+		}
+		for _, test := range []struct {
+			name string
+			pred func(int) bool
+		}{
+			{"none", func(int) bool { return false }},
+			{"all", func(int) bool { return true }},
+			{"even", func(x int) bool { return x%2 == 0 }},
+			{"prefix", func(x int) bool { return x < n/3 }},
+			{"random", func(x int) bool { return x*7%5 < 2 }},
+		} {
+			t.Run(fmt.Sprintf("%s/%d", test.name, n), func(t *testing.T) {
+				var in, out []int
+				for x := 0; x < n; x++ {
+					if test.pred(x) {
+						in = append(in, x)
+					} else {
+						out = append(out, x)
+					}
+				}
+				pred := func(x Item) bool {
+					return test.pred(int(x.(IntItem)))
+				}
+				assertTree(t, tree.Filter(pred), in)
+				a, b := tree.Partition(pred)
+				assertTree(t, a, in)
+				assertTree(t, b, out)
+				assertTree(t, tree, makeRange(0, n))
+			})
+		}
+	}
+}
+
+func TestFilterShared(t *testing.T) {
+	tree := buildTreeFrom(makeRange(0, 100)...)
+	if act := tree.Filter(func(Item) bool { return true }); !act.Unchanged(tree) {
+		t.Fatalf("tree is changed after filtering with true predicate")
+	}
+	// Filtering out the max value must copy only the right spine.
+	act := tree.Filter(func(x Item) bool { return x != IntItem(99) })
+	if act.root.left != tree.root.left {
+		t.Fatalf("left subtree is not shared")
+	}
+}
+
+func TestMapValues(t *testing.T) {
+	var tree Tree
+	for i := 0; i < 100; i++ {
+		tree, _ = tree.Insert(pair{i, i})
+	}
+	act := tree.MapValues(func(x Item) Item {
+		p := x.(pair)
+		p.value *= 2
+		return p
+	})
+	keys := func(t Tree) (ks []int) {
+		for _, x := range preOrder(t) {
+			ks = append(ks, x.(pair).key)
+		}
+		return ks
+	}
+	if a, b := keys(act), keys(tree); fmt.Sprint(a) != fmt.Sprint(b) {
+		t.Fatalf("tree shape is changed:\n%v\nwant:\n%v", a, b)
+	}
+	act.InOrder(func(x Item) bool {
+		if p := x.(pair); p.value != p.key*2 {
+			t.Fatalf("unexpected value: %v", p)
+		}
+		return true
+	})
+	if act.Size() != tree.Size() {
+		t.Fatalf("unexpected size: %d; want %d", act.Size(), tree.Size())
+	}
+}
+
+func TestFoldReduce(t *testing.T) {
+	var empty Tree
+	if act := empty.Reduce(nil); act != nil {
+		t.Fatalf("unexpected Reduce() result for empty tree: %v", act)
+	}
+	if act := empty.Fold(42, nil); act != 42 {
+		t.Fatalf("unexpected Fold() result for empty tree: %v", act)
+	}
+	tree := buildTreeFrom(makeRange(1, 11)...)
+	sum := tree.Fold(0, func(acc interface{}, x Item) interface{} {
+		return acc.(int) + int(x.(IntItem))
+	})
+	if sum != 55 {
+		t.Fatalf("unexpected Fold() result: %v; want 55", sum)
+	}
+	var order []string
+	last := tree.Reduce(func(acc, x Item) Item {
+		order = append(order, fmt.Sprint(acc, x))
+		return x
+	})
+	if last != IntItem(10) || len(order) != 9 || order[0] != "1 2" {
+		t.Fatalf("unexpected Reduce() calls: %v", order)
+	}
+
+	// Nil result of fn must be passed to the next call.
+	var calls int
+	nilTree := buildTreeFrom(1, 2, 3, 4)
+	act := nilTree.Reduce(func(acc, x Item) Item {
+		if calls++; calls > 1 && acc != nil {
+			t.Fatalf("unexpected accumulator: %v", acc)
+		}
+		return nil
+	})
+	if act != nil || calls != 3 {
+		t.Fatalf("unexpected Reduce() result: %v after %d calls; want nil after 3", act, calls)
+	}
+}
@@ -8,8 +8,9 @@ package avl
 // makes Tree so called reference type. That is, there is no cases when you may
 // need to pass pointer to instance of the Tree.
 type Tree struct {
-	root *node
-	size int
+	root   *node
+	size   int
+	merkle *merkle
 }
 
 // Size returns the size of a tree.
@@ -26,6 +27,7 @@ func (t Tree) Insert(x Item) (_ Tree, existing Item) {
 	if existing == nil {
 		t.size++
 	}
+	t.root = t.merkle.rehash(t.root)
 	return t, existing
 }
 
@@ -33,11 +35,15 @@ func (t Tree) Insert(x Item) (_ Tree, existing Item) {
 // It replaces the value of a node in the tree if it already exists or inserts
 // new one with value x. It returns a copy of the tree and an old value if it
 // was present and replaced by x.
+//
+// If x implements Equaler and is equal to the old value, the tree is left
+// unchanged.
 func (t Tree) Update(x Item) (_ Tree, prev Item) {
 	t.root, prev = t.root.Update(x)
 	if prev == nil {
 		t.size++
 	}
+	t.root = t.merkle.rehash(t.root)
 	return t, prev
 }
 
@@ -49,9 +55,57 @@ func (t Tree) Delete(x Item) (_ Tree, existed Item) {
 	if existed != nil {
 		t.size--
 	}
+	t.root = t.merkle.rehash(t.root)
 	return t, existed
 }
 
+// Action is an action made by Modify().
+type Action int
+
+const (
+	// ActionKeep leaves the tree unchanged.
+	ActionKeep Action = iota
+
+	// ActionPut inserts the returned item or replaces the existing one with
+	// it. Returned item must be equal to x in terms of Compare().
+	ActionPut
+
+	// ActionDelete deletes the existing item. If there is no such item it is
+	// the same as ActionKeep.
+	ActionDelete
+)
+
+// Modify searches for an item equal to x and calls fn with it; if there is
+// no such item fn is called with nil and false. Depending on action returned
+// by fn, Modify inserts, replaces or deletes the item or leaves the tree
+// unchanged. That is, it implements read-modify-write in a single descent.
+//
+// It returns a copy of the tree and the item passed to fn. If fn returned
+// ActionKeep, ActionDelete for absent item or ActionPut with an item equal to
+// the existing one (see Equaler), the returned tree is identical to t and no
+// allocations are made.
+//
+// It panics if item returned with ActionPut is not equal to x.
+func (t Tree) Modify(x Item, fn func(old Item, found bool) (Item, Action)) (_ Tree, old Item) {
+	var act Action
+	t.root, old, act = t.root.Modify(x, fn)
+	switch {
+	case act == ActionPut && old == nil:
+		t.size++
+	case act == ActionDelete:
+		t.size--
+	}
+	t.root = t.merkle.rehash(t.root)
+	return t, old
+}
+
+// Unchanged reports whether t is identical to prev, that is, t was derived
+// from prev by operations which made no changes.
+// The time complexity is O(1).
+func (t Tree) Unchanged(prev Tree) bool {
+	return t.root == prev.root && t.merkle == prev.merkle
+}
+
 // Max returns max value of the tree.
 func (t Tree) Max() Item {
 	return t.root.Max()
@@ -62,6 +116,32 @@ func (t Tree) Min() Item {
 	return t.root.Min()
 }
 
+// PopMin deletes the min value of the tree.
+// It returns a copy of the tree and the deleted value, which is nil if the
+// tree is empty. Unlike Min() followed by Delete(), it descends the tree
+// once.
+func (t Tree) PopMin() (_ Tree, min Item) {
+	t.root, min = t.root.PopMin()
+	if min != nil {
+		t.size--
+	}
+	t.root = t.merkle.rehash(t.root)
+	return t, min
+}
+
+// PopMax deletes the max value of the tree.
+// It returns a copy of the tree and the deleted value, which is nil if the
+// tree is empty. Unlike Max() followed by Delete(), it descends the tree
+// once.
+func (t Tree) PopMax() (_ Tree, max Item) {
+	t.root, max = t.root.PopMax()
+	if max != nil {
+		t.size--
+	}
+	t.root = t.merkle.rehash(t.root)
+	return t, max
+}
+
 // Search searches for a node having value x and return its value.
 // Note that x and node's value essentially can be a different types sharing
 // comparison logic.
@@ -81,6 +161,27 @@ func (t Tree) Successor(x Item) Item {
 	return t.root.Successor(x)
 }
 
+// Floor finds the greatest value in the tree which is less than or equal to
+// x. It returns found value or nil.
+func (t Tree) Floor(x Item) Item {
+	return t.root.Floor(x)
+}
+
+// Ceiling finds the least value in the tree which is greater than or equal to
+// x. It returns found value or nil.
+func (t Tree) Ceiling(x Item) Item {
+	return t.root.Ceiling(x)
+}
+
+// Nearest finds the value in the tree closest to x. The distance function is
+// called with x and values of the tree; it must be consistent with the tree
+// order, such that the closest value is either floor or ceiling of x. If
+// floor and ceiling are at equal distance, the floor is returned. It returns
+// found value or nil if the tree is empty.
+func (t Tree) Nearest(x Item, distance func(x, y Item) float64) Item {
+	return t.root.Nearest(x, distance)
+}
+
 // InOrder prepares in-order traversal of the tree and calls fn with value of
 // each visited node. If fn returns false it stops traversal.
 func (t Tree) InOrder(fn func(Item) bool) {
@@ -98,3 +199,22 @@ func (t Tree) PreOrder(fn func(Item) bool) {
 func (t Tree) PostOrder(fn func(Item) bool) {
 	t.root.PostOrder(fn)
 }
+
+// Canonical returns a tree holding the same items as t, but having the shape
+// which depends only on the number of items and not on the history of
+// modifications. That is, canonical trees holding equal sets of items are
+// traversed in the same order by PreOrder() and PostOrder(), and Merkle
+// canonical trees have equal root hashes.
+//
+// Note that modifying the canonical tree makes it non-canonical in general.
+// The time complexity is O(n).
+func (t Tree) Canonical() Tree {
+	items := make([]Item, 0, t.size)
+	t.root.InOrder(func(x Item) bool {
+		items = append(items, x)
+		return true
+	})
+	t.root = build(items)
+	t.root = t.merkle.rehash(t.root)
+	return t
+}
@@ -0,0 +1,174 @@
+package avl
+
+// View is a read-only view of a tree limited to values greater than or equal
+// to lo and less than hi. Nil lo or hi means no lower or upper bound
+// respectively.
+//
+// Bounds are applied lazily on each call, that is, creating a View does not
+// copy any nodes. Note that bounds are compared with tree values the same way
+// as Search() argument is.
+type View struct {
+	tree Tree
+	lo   Item
+	hi   Item
+}
+
+// Sub returns a view of the tree limited to values greater than or equal to
+// lo and less than hi.
+func (t Tree) Sub(lo, hi Item) View {
+	return View{t, lo, hi}
+}
+
+// Head returns a view of the tree limited to values less than hi.
+func (t Tree) Head(hi Item) View {
+	return View{t, nil, hi}
+}
+
+// Tail returns a view of the tree limited to values greater than or equal to
+// lo.
+func (t Tree) Tail(lo Item) View {
+	return View{t, lo, nil}
+}
+
+// Tree returns a tree holding values of the view.
+// The time complexity is O(log n + k), where k is the size of the view.
+func (v View) Tree() Tree {
+	return v.tree.Slice(v.lo, v.hi)
+}
+
+// Size returns the number of values in the view.
+// The time complexity is O(log n + k), where k is the size of the view.
+func (v View) Size() (size int) {
+	if v.lo == nil && v.hi == nil {
+		return v.tree.Size()
+	}
+	v.InOrder(func(Item) bool {
+		size++
+		return true
+	})
+	return size
+}
+
+// Rank returns the number of values in the view which are less than x.
+// The time complexity is O(log n + k), where k is the rank.
+func (v View) Rank(x Item) (rank int) {
+	v.InOrder(func(y Item) bool {
+		if x.Compare(y) <= 0 {
+			return false
+		}
+		rank++
+		return true
+	})
+	return rank
+}
+
+// Min returns min value of the view.
+func (v View) Min() Item {
+	if v.lo == nil {
+		return v.bound(v.tree.root.Min())
+	}
+	return v.bound(v.tree.root.Ceiling(v.lo))
+}
+
+// Max returns max value of the view.
+func (v View) Max() Item {
+	if v.hi == nil {
+		return v.bound(v.tree.root.Max())
+	}
+	return v.bound(v.tree.root.last(v.hi))
+}
+
+// Search searches for a value of the view equal to x.
+func (v View) Search(x Item) Item {
+	return v.bound(v.tree.Search(x))
+}
+
+// Predecessor returns the greatest value of the view which is less than x.
+func (v View) Predecessor(x Item) Item {
+	p := v.tree.Predecessor(x)
+	if p != nil && v.hi != nil && v.hi.Compare(p) <= 0 {
+		// x is above the view.
+		return v.Max()
+	}
+	return v.bound(p)
+}
+
+// Successor returns the least value of the view which is greater than x.
+func (v View) Successor(x Item) Item {
+	s := v.tree.Successor(x)
+	if s != nil && v.lo != nil && v.lo.Compare(s) > 0 {
+		// x is below the view.
+		return v.Min()
+	}
+	return v.bound(s)
+}
+
+// InOrder prepares in-order traversal of the view and calls fn with each
+// value. If fn returns false it stops traversal.
+func (v View) InOrder(fn func(Item) bool) {
+	v.tree.root.ascend(v.lo, v.hi, fn)
+}
+
+// PreOrder prepares pre-order traversal of the underlying tree and calls fn
+// with each value of the view. Subtrees out of the view are not visited. If
+// fn returns false it stops traversal.
+func (v View) PreOrder(fn func(Item) bool) {
+	v.walk(v.tree.root, fn, true)
+}
+
+// PostOrder prepares post-order traversal of the underlying tree and calls fn
+// with each value of the view. Subtrees out of the view are not visited. If
+// fn returns false it stops traversal.
+func (v View) PostOrder(fn func(Item) bool) {
+	v.walk(v.tree.root, fn, false)
+}
+
+func (v View) walk(n *node, fn func(Item) bool, pre bool) bool {
+	if n == nil {
+		return true
+	}
+	var (
+		left  = v.lo == nil || v.lo.Compare(n.value) < 0
+		right = v.hi == nil || v.hi.Compare(n.value) > 0
+		self  = v.contains(n.value)
+	)
+	if pre && self && !fn(n.value) {
+		return false
+	}
+	if left && !v.walk(n.left, fn, pre) {
+		return false
+	}
+	if right && !v.walk(n.right, fn, pre) {
+		return false
+	}
+	if !pre && self && !fn(n.value) {
+		return false
+	}
+	return true
+}
+
+func (v View) contains(x Item) bool {
+	return (v.lo == nil || v.lo.Compare(x) <= 0) &&
+		(v.hi == nil || v.hi.Compare(x) > 0)
+}
+
+// bound returns x if it is in the view and nil otherwise.
+func (v View) bound(x Item) Item {
+	if x == nil || !v.contains(x) {
+		return nil
+	}
+	return x
+}
+
+// last returns the greatest value which is less than x.
+func (n *node) last(x Item) Item {
+	var ret Item
+	for n != nil {
+		if x.Compare(n.value) > 0 {
+			ret, n = n.value, n.right
+		} else {
+			n = n.left
+		}
+	}
+	return ret
+}
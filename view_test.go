@@ -0,0 +1,121 @@
+package avl
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	// Tree holds even numbers from 0 to 18.
+	var tree Tree
+	for i := 0; i < 10; i++ {
+		tree, _ = tree.Insert(IntItem(i * 2))
+	}
+	for lo := -2; lo <= 21; lo++ {
+		for hi := -2; hi <= 21; hi++ {
+			for _, v := range []View{
+				tree.Sub(IntItem(lo), IntItem(hi)),
+				tree.Head(IntItem(hi)),
+				tree.Tail(IntItem(lo)),
+				tree.Sub(nil, nil),
+			} {
+				t.Run(fmt.Sprintf("[%v,%v)", v.lo, v.hi), func(t *testing.T) {
+					assertView(t, v)
+				})
+			}
+		}
+	}
+}
+
+func assertView(t *testing.T, v View) {
+	var exp []int
+	v.tree.InOrder(func(x Item) bool {
+		if v.contains(x) {
+			exp = append(exp, int(x.(IntItem)))
+		}
+		return true
+	})
+	assertOrder(t, "in-order", exp, func(fn func(Item) bool) bool {
+		v.InOrder(fn)
+		return true
+	})
+	assertOrder(t, "view tree", exp, func(fn func(Item) bool) bool {
+		v.Tree().InOrder(fn)
+		return true
+	})
+	var pre, post []Item
+	v.PreOrder(func(x Item) bool {
+		pre = append(pre, x)
+		return true
+	})
+	v.PostOrder(func(x Item) bool {
+		post = append(post, x)
+		return true
+	})
+	// Pruned traversals must preserve the order of the full ones.
+	var expPre, expPost []Item
+	v.tree.PreOrder(func(x Item) bool {
+		if v.contains(x) {
+			expPre = append(expPre, x)
+		}
+		return true
+	})
+	v.tree.PostOrder(func(x Item) bool {
+		if v.contains(x) {
+			expPost = append(expPost, x)
+		}
+		return true
+	})
+	if fmt.Sprint(pre) != fmt.Sprint(expPre) {
+		t.Errorf("unexpected pre-order: %v; want %v", pre, expPre)
+	}
+	if fmt.Sprint(post) != fmt.Sprint(expPost) {
+		t.Errorf("unexpected post-order: %v; want %v", post, expPost)
+	}
+	if n := v.Size(); n != len(exp) {
+		t.Errorf("unexpected size: %d; want %d", n, len(exp))
+	}
+	find := func(fn func(int) bool) Item {
+		for _, x := range exp {
+			if fn(x) {
+				return IntItem(x)
+			}
+		}
+		return nil
+	}
+	findLast := func(fn func(int) bool) Item {
+		for i := len(exp) - 1; i >= 0; i-- {
+			if fn(exp[i]) {
+				return IntItem(exp[i])
+			}
+		}
+		return nil
+	}
+	assertViewItem(t, "min", v.Min(), find(func(int) bool { return true }))
+	assertViewItem(t, "max", v.Max(), findLast(func(int) bool { return true }))
+	for x := -3; x <= 22; x++ {
+		assertViewItem(t, fmt.Sprintf("search(%d)", x), v.Search(IntItem(x)),
+			find(func(y int) bool { return y == x }))
+		assertViewItem(t, fmt.Sprintf("predecessor(%d)", x), v.Predecessor(IntItem(x)),
+			findLast(func(y int) bool { return y < x }))
+		assertViewItem(t, fmt.Sprintf("successor(%d)", x), v.Successor(IntItem(x)),
+			find(func(y int) bool { return y > x }))
+
+		var rank int
+		for _, y := range exp {
+			if y < x {
+				rank++
+			}
+		}
+		if act := v.Rank(IntItem(x)); act != rank {
+			t.Errorf("unexpected rank(%d): %d; want %d", x, act, rank)
+		}
+	}
+}
+
+func assertViewItem(t *testing.T, name string, act, exp Item) {
+	t.Helper()
+	if act != exp {
+		t.Errorf("unexpected %s: %v; want %v", name, act, exp)
+	}
+}
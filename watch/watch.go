@@ -0,0 +1,329 @@
+/*
+Package watch implements a container of avl.Tree which notifies subscribers
+about published versions of the tree.
+
+It replaces polling of a shared tree: readers subscribe to changes of the
+whole tree or a range of items and receive events holding added, removed and
+changed items. Changes are computed with avl.Diff(), which skips subtrees
+shared by consecutive versions.
+*/
+package watch
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gobwas/avl"
+)
+
+// ErrNoVersion is returned by Subscribe() when the version to resume from is
+// not present in the container's history.
+var ErrNoVersion = errors.New("watch: version is not in history")
+
+const defaultBuffer = 16
+
+// Change describes a change of a single item. Old is nil for added items and
+// New is nil for removed items.
+type Change struct {
+	Old avl.Item
+	New avl.Item
+}
+
+// Event holds changes made by one or more published versions.
+type Event struct {
+	// Version is the version of the tree after the changes.
+	Version uint64
+
+	Changes []Change
+}
+
+// Policy defines what happens when a subscriber does not keep up with
+// published versions.
+type Policy int
+
+const (
+	// Block makes Publish() wait until the subscriber receives the event.
+	Block Policy = iota
+
+	// Drop drops the events which do not fit into subscriber's buffer.
+	// The number of dropped events is reported by Subscription.Dropped().
+	Drop
+
+	// Coalesce merges pending events into one, such that the subscriber
+	// receives the changes between the last received and the latest
+	// versions of the tree.
+	Coalesce
+)
+
+// Options holds subscription parameters. Nil *Options means defaults.
+type Options struct {
+	// Lo and Hi limit the changes delivered to subscriber to the items
+	// greater than or equal to Lo and less than Hi. Nil Lo or Hi means no
+	// lower or upper bound respectively.
+	Lo avl.Item
+	Hi avl.Item
+
+	// Policy is the backpressure policy. Default is Block.
+	Policy Policy
+
+	// Buffer is the capacity of the events channel.
+	// If zero, the default of 16 is used.
+	Buffer int
+
+	// Resume makes the subscriber to receive the changes made after version
+	// From as the first event.
+	Resume bool
+	From   uint64
+}
+
+type snapshot struct {
+	tree    avl.Tree
+	version uint64
+}
+
+// Container holds versions of a tree and notifies subscribers about them.
+// It is safe for concurrent use.
+type Container struct {
+	mu      sync.Mutex
+	history []snapshot
+	size    int
+	subs    map[*Subscription]struct{}
+}
+
+// New creates a new Container holding t as version zero. The container
+// keeps up to history last versions to let subscribers resume from them.
+func New(t avl.Tree, history int) *Container {
+	if history < 1 {
+		history = 1
+	}
+	return &Container{
+		history: []snapshot{{tree: t}},
+		size:    history,
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Current returns the current version of the tree and its number.
+func (c *Container) Current() (avl.Tree, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.current()
+	return s.tree, s.version
+}
+
+func (c *Container) current() snapshot {
+	return c.history[len(c.history)-1]
+}
+
+// Publish makes t the current version of the tree and notifies subscribers.
+// It returns the number of published version.
+//
+// Note that Publish() blocks until all subscribers with Block policy receive
+// the event.
+func (c *Container) Publish(t avl.Tree) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev := c.current()
+	next := snapshot{
+		tree:    t,
+		version: prev.version + 1,
+	}
+	if len(c.history) == c.size {
+		copy(c.history, c.history[1:])
+		c.history = c.history[:len(c.history)-1]
+	}
+	c.history = append(c.history, next)
+
+	var changes []Change
+	avl.Diff(prev.tree, t, func(x, y avl.Item) bool {
+		changes = append(changes, Change{Old: x, New: y})
+		return true
+	})
+	for s := range c.subs {
+		s.publish(next.version, changes)
+	}
+	return next.version
+}
+
+// Subscribe subscribes to the changes of the tree.
+func (c *Container) Subscribe(opts *Options) (*Subscription, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Buffer <= 0 {
+		o.Buffer = defaultBuffer
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cur := c.current()
+	base := cur
+	if o.Resume {
+		i := len(c.history) - 1 - int(cur.version-o.From)
+		if o.From > cur.version || i < 0 {
+			return nil, ErrNoVersion
+		}
+		base = c.history[i]
+	}
+	ch := make(chan Event, o.Buffer)
+	s := &Subscription{
+		C:    ch,
+		c:    c,
+		ch:   ch,
+		opts: o,
+		done: make(chan struct{}),
+	}
+	if o.Policy == Coalesce {
+		s.base = base
+		s.notify = make(chan struct{}, 1)
+		s.exit = make(chan struct{})
+		go s.coalesce()
+		if base.version != cur.version {
+			s.notify <- struct{}{}
+		}
+	} else if base.version != cur.version {
+		var changes []Change
+		avl.Diff(base.tree, cur.tree, func(x, y avl.Item) bool {
+			changes = append(changes, Change{Old: x, New: y})
+			return true
+		})
+		s.publish(cur.version, changes)
+	}
+	c.subs[s] = struct{}{}
+
+	return s, nil
+}
+
+// Subscription is a subscription to the changes of a tree.
+type Subscription struct {
+	// C is the channel of events. It is closed by Close().
+	C <-chan Event
+
+	c       *Container
+	ch      chan Event
+	opts    Options
+	dropped uint64
+	once    sync.Once
+	done    chan struct{}
+
+	// Fields used by Coalesce policy.
+	base   snapshot
+	notify chan struct{}
+	exit   chan struct{}
+}
+
+// Dropped returns the number of events dropped due to Drop policy.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close cancels the subscription and closes the events channel.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		// Unblock Publish() first, since it holds the container's lock.
+		close(s.done)
+
+		s.c.mu.Lock()
+		delete(s.c.subs, s)
+		s.c.mu.Unlock()
+
+		if s.exit != nil {
+			<-s.exit
+		}
+		close(s.ch)
+	})
+}
+
+// publish delivers changes to the subscriber. It must be called with the
+// container's lock held.
+func (s *Subscription) publish(version uint64, changes []Change) {
+	if s.opts.Policy == Coalesce {
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+		return
+	}
+	changes = s.filter(changes)
+	if len(changes) == 0 {
+		return
+	}
+	e := Event{
+		Version: version,
+		Changes: changes,
+	}
+	if s.opts.Policy == Drop {
+		select {
+		case s.ch <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+		return
+	}
+	select {
+	case s.ch <- e:
+	case <-s.done:
+	}
+}
+
+// coalesce delivers changes between the last delivered and the current
+// versions of the tree each time it is notified.
+func (s *Subscription) coalesce() {
+	defer close(s.exit)
+	for {
+		select {
+		case <-s.notify:
+		case <-s.done:
+			return
+		}
+		s.c.mu.Lock()
+		cur := s.c.current()
+		s.c.mu.Unlock()
+
+		var changes []Change
+		avl.Diff(s.base.tree, cur.tree, func(x, y avl.Item) bool {
+			if s.inRange(x, y) {
+				changes = append(changes, Change{Old: x, New: y})
+			}
+			return true
+		})
+		s.base = cur
+		if len(changes) == 0 {
+			continue
+		}
+		select {
+		case s.ch <- Event{Version: cur.version, Changes: changes}:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Subscription) filter(changes []Change) []Change {
+	if s.opts.Lo == nil && s.opts.Hi == nil {
+		return changes
+	}
+	var ret []Change
+	for _, c := range changes {
+		if s.inRange(c.Old, c.New) {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+func (s *Subscription) inRange(x, y avl.Item) bool {
+	if x == nil {
+		x = y
+	}
+	if lo := s.opts.Lo; lo != nil && lo.Compare(x) > 0 {
+		return false
+	}
+	if hi := s.opts.Hi; hi != nil && hi.Compare(x) <= 0 {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,202 @@
+package watch
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gobwas/avl"
+)
+
+func TestSubscribe(t *testing.T) {
+	var tree avl.Tree
+	c := New(tree, 4)
+	all, err := c.Subscribe(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer all.Close()
+	part, err := c.Subscribe(&Options{
+		Lo: item{key: 10},
+		Hi: item{key: 20},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer part.Close()
+
+	tree = insert(tree, 5, 15, 25)
+	c.Publish(tree)
+	tree, _ = tree.Update(item{key: 15, value: 1})
+	tree, _ = tree.Delete(item{key: 5})
+	c.Publish(tree)
+
+	assertEvent(t, <-all.C, 1, "[+5 +15 +25]")
+	assertEvent(t, <-all.C, 2, "[-5 ~15]")
+	assertEvent(t, <-part.C, 1, "[+15]")
+	assertEvent(t, <-part.C, 2, "[~15]")
+
+	// Versions without changes in range must not be delivered.
+	tree = insert(tree, 30)
+	c.Publish(tree)
+	tree = insert(tree, 11)
+	c.Publish(tree)
+	assertEvent(t, <-part.C, 4, "[+11]")
+}
+
+func TestSubscribeDrop(t *testing.T) {
+	var tree avl.Tree
+	c := New(tree, 1)
+	s, err := c.Subscribe(&Options{
+		Policy: Drop,
+		Buffer: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		tree = insert(tree, i)
+		c.Publish(tree)
+	}
+	assertEvent(t, <-s.C, 1, "[+0]")
+	if n := s.Dropped(); n != 2 {
+		t.Fatalf("unexpected number of dropped events: %d; want %d", n, 2)
+	}
+}
+
+func TestSubscribeCoalesce(t *testing.T) {
+	var tree avl.Tree
+	c := New(tree, 1)
+	s, err := c.Subscribe(&Options{
+		Policy: Coalesce,
+		Buffer: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 100; i++ {
+		tree = insert(tree, i)
+		c.Publish(tree)
+	}
+	tree, _ = tree.Delete(item{key: 0})
+	c.Publish(tree)
+
+	// Events may be merged in any way, but the last one must be version
+	// 101 and all changes must be observed.
+	seen := make(map[int]bool)
+	for {
+		var e Event
+		select {
+		case e = <-s.C:
+		case <-time.After(time.Second):
+			t.Fatalf("no event received")
+		}
+		for _, ch := range e.Changes {
+			if ch.New != nil {
+				seen[ch.New.(item).key] = true
+			} else {
+				delete(seen, ch.Old.(item).key)
+			}
+		}
+		if e.Version == 101 {
+			break
+		}
+	}
+	if len(seen) != 99 || seen[0] {
+		t.Fatalf("unexpected coalesced state: %d items", len(seen))
+	}
+}
+
+func TestSubscribeBlock(t *testing.T) {
+	var tree avl.Tree
+	c := New(tree, 1)
+	s, err := c.Subscribe(&Options{
+		Buffer: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Publish(insert(tree, 1))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Publish(insert(tree, 2))
+	}()
+	select {
+	case <-done:
+		t.Fatalf("Publish() did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// Close must unblock the publisher.
+	s.Close()
+	<-done
+}
+
+func TestSubscribeResume(t *testing.T) {
+	var tree avl.Tree
+	c := New(tree, 3)
+	for i := 0; i < 5; i++ {
+		tree = insert(tree, i)
+		c.Publish(tree)
+	}
+	if _, err := c.Subscribe(&Options{Resume: true, From: 1}); err != ErrNoVersion {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrNoVersion)
+	}
+	if _, err := c.Subscribe(&Options{Resume: true, From: 6}); err != ErrNoVersion {
+		t.Fatalf("unexpected error: %v; want %v", err, ErrNoVersion)
+	}
+	for _, policy := range []Policy{Block, Drop, Coalesce} {
+		s, err := c.Subscribe(&Options{
+			Policy: policy,
+			Resume: true,
+			From:   3,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEvent(t, <-s.C, 5, "[+3 +4]")
+		s.Close()
+	}
+}
+
+func assertEvent(t *testing.T, e Event, version uint64, changes string) {
+	t.Helper()
+	if e.Version != version {
+		t.Fatalf("unexpected version: %d; want %d", e.Version, version)
+	}
+	var act []string
+	for _, c := range e.Changes {
+		switch {
+		case c.Old == nil:
+			act = append(act, fmt.Sprintf("+%d", c.New.(item).key))
+		case c.New == nil:
+			act = append(act, fmt.Sprintf("-%d", c.Old.(item).key))
+		default:
+			act = append(act, fmt.Sprintf("~%d", c.New.(item).key))
+		}
+	}
+	if s := fmt.Sprint(act); s != changes {
+		t.Fatalf("unexpected changes: %s; want %s", s, changes)
+	}
+}
+
+func insert(t avl.Tree, keys ...int) avl.Tree {
+	for _, k := range keys {
+		t, _ = t.Insert(item{key: k})
+	}
+	return t
+}
+
+type item struct {
+	key   int
+	value int
+}
+
+func (a item) Compare(b avl.Item) int {
+	return a.key - b.(item).key
+}